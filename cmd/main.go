@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,8 +11,12 @@ import (
 	"time"
 
 	api "github.com/glkeru/EM_Subscriptions/internal/api"
+	budget "github.com/glkeru/EM_Subscriptions/internal/budget"
 	config "github.com/glkeru/EM_Subscriptions/internal/config"
 	db "github.com/glkeru/EM_Subscriptions/internal/db"
+	events "github.com/glkeru/EM_Subscriptions/internal/events"
+	grpcapi "github.com/glkeru/EM_Subscriptions/internal/grpc"
+	notify "github.com/glkeru/EM_Subscriptions/internal/notify"
 	"github.com/rs/cors"
 	"go.uber.org/zap"
 )
@@ -31,13 +36,28 @@ func main() {
 	defer logger.Sync()
 
 	// database
-	repo, err := db.NewRepository(conf)
+	dbrepo, err := db.NewRepository(conf)
 	if err != nil {
 		log.Fatal("database connection fatal error", err)
 	}
 
+	// события изменения подписок
+	hub := events.NewHub(conf.EventsBuffer)
+	evrepo := events.NewRepository(dbrepo, hub)
+
+	// предупреждения по бюджетам
+	notifier, err := notify.NewNotifier(conf, logger)
+	if err != nil {
+		log.Fatal("notifier fatal error", err)
+	}
+	budgets := budget.NewChecker(evrepo, notifier, logger, conf)
+	repo := budget.NewRepository(evrepo, budgets)
+
 	// server
-	r, err := api.NewServer(repo, logger, conf)
+	r, err := api.NewServer(repo, budgets, hub, logger, conf)
+	if err != nil {
+		log.Fatal("server fatal error", err)
+	}
 
 	crs := cors.New(cors.Options{
 		AllowedOrigins: []string{"http://localhost:8088", "http://127.0.0.1:8088"}})
@@ -49,6 +69,8 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 		ReadTimeout:  10 * time.Second,
 	}
+	// иначе открытые потоки событий держат Shutdown до таймаута
+	srv.RegisterOnShutdown(hub.Close)
 	logger.Info("server starting")
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -56,12 +78,27 @@ func main() {
 		}
 	}()
 
+	// gRPC сервер
+	lis, err := net.Listen("tcp", ":"+conf.GRPCPort)
+	if err != nil {
+		log.Fatal("grpc listen error", err)
+	}
+	gsrv, gapi := grpcapi.NewServer(repo, logger, conf)
+	logger.Info("grpc server starting")
+	go func() {
+		if err := gsrv.Serve(lis); err != nil {
+			log.Fatal("start grpc server error", err)
+		}
+	}()
+
 	// shutdown
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
 	<-interrupt
 	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	gapi.Shutdown()
+	gsrv.GracefulStop()
 	err = srv.Shutdown(timeout)
 	if err != nil {
 		logger.Error("shutdown error", zap.Error(err))
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	config "github.com/glkeru/EM_Subscriptions/internal/config"
+	db "github.com/glkeru/EM_Subscriptions/internal/db"
+)
+
+// сверка помесячного агрегата monthly_rollup с подписками
+// -rebuild: пересобрать агрегат и проверить еще раз
+func main() {
+	rebuild := flag.Bool("rebuild", false, "rebuild monthly_rollup from subscriptions")
+	timeout := flag.Duration("timeout", 10*time.Minute, "operation timeout")
+	flag.Parse()
+
+	// config
+	conf, err := config.ConfigLoad()
+	if err != nil {
+		log.Fatal("config fatal error", err)
+	}
+
+	// database
+	repo, err := db.NewRepository(conf)
+	if err != nil {
+		log.Fatal("database connection fatal error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if *rebuild {
+		err = repo.RollupRebuild(ctx)
+		if err != nil {
+			log.Fatal("rollup rebuild error ", err)
+		}
+		log.Println("rollup rebuilt")
+	}
+
+	diffs, err := repo.RollupCheck(ctx)
+	if err != nil {
+		log.Fatal("rollup check error ", err)
+	}
+	for _, d := range diffs {
+		fmt.Printf("%s\t%s\t%s\tamount expected %d actual %d\tactive delta expected %d actual %d\n",
+			d.Month.Format("01-2006"), d.ServiceName, d.UserId, d.ExpectedAmount, d.ActualAmount, d.ExpectedCount, d.ActualCount)
+	}
+	if len(diffs) > 0 {
+		log.Printf("rollup is inconsistent: %d rows differ, run with -rebuild", len(diffs))
+		os.Exit(1)
+	}
+	log.Println("rollup is consistent")
+}
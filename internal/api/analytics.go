@@ -0,0 +1,515 @@
+package emsub
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	utils "github.com/glkeru/EM_Subscriptions/internal/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// максимальная длина временного ряда, месяцев
+const MaxSeriesMonths = 600
+
+// TimeSeries
+func (s *Server) SubscriptionTimeSeries(w http.ResponseWriter, req *http.Request) {
+	vars := req.URL.Query()
+
+	f, err := parseFilter(vars)
+	if err != nil {
+		s.LogError("filter format is wrong", "SubscriptionTimeSeries", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+	// начало периода обязательно, конец по умолчанию - текущий месяц
+	if f.Start == nil {
+		s.LogError("start_date is required", "SubscriptionTimeSeries", nil, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, "start_date is required"))
+		return
+	}
+	if f.End == nil {
+		end := utils.MonthStart(time.Now())
+		f.End = &end
+	}
+	months := utils.MonthsBetween(*f.Start, *f.End)
+	if months <= 0 || months > MaxSeriesMonths {
+		s.LogError("period is wrong", "SubscriptionTimeSeries", nil, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, "end_date must not be before start_date, period is limited to 600 months"))
+		return
+	}
+
+	cumulative := vars.Get("cumulative") == "true"
+	compare := vars.Get("compare")
+	if compare != "" && compare != "previous_year" {
+		s.LogError("compare format is wrong", "SubscriptionTimeSeries", nil, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, "compare must be previous_year"))
+		return
+	}
+
+	points, err := s.repo.SubscriptionTimeSeries(req.Context(), f)
+	if err != nil {
+		s.LogError("DB time series error", "SubscriptionTimeSeries", err, vars)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	// те же месяцы годом ранее
+	var previous []model.MonthTotal
+	if compare != "" {
+		prevStart := f.Start.AddDate(-1, 0, 0)
+		prevEnd := f.End.AddDate(-1, 0, 0)
+		pf := f
+		pf.Start, pf.End = &prevStart, &prevEnd
+		previous, err = s.repo.SubscriptionTimeSeries(req.Context(), pf)
+		if err != nil {
+			s.LogError("DB time series error", "SubscriptionTimeSeries", err, vars)
+			s.writeError(w, req, ErrInternal)
+			return
+		}
+	}
+
+	resp := &TimeSeriesResponse{}
+	resp.Points = make([]TimeSeriesPoint, 0, len(points))
+	var sum, prevSum uint
+	for i, p := range points {
+		var point TimeSeriesPoint
+		point.Month = p.Month.Format(DateFormat)
+		point.Total = p.Total
+		point.Count = p.Count
+		sum += p.Total
+		value := p.Total
+		if cumulative {
+			c := sum
+			point.Cumulative = &c
+			value = sum
+		}
+		if compare != "" && i < len(previous) {
+			prevSum += previous[i].Total
+			prev := previous[i].Total
+			if cumulative {
+				prev = prevSum
+			}
+			point.Previous = &prev
+			delta := int64(value) - int64(prev)
+			point.Delta = &delta
+			if prev != 0 {
+				pct := float64(delta) * 100 / float64(prev)
+				point.DeltaPercent = &pct
+			}
+		}
+		resp.Points = append(resp.Points, point)
+	}
+	resp.Total = sum
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "SubscriptionTimeSeries", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// горизонт прогноза по умолчанию и максимальный, месяцев
+const (
+	DefaultForecastMonths = 12
+	MaxForecastMonths     = 120
+)
+
+// Forecast
+func (s *Server) SubscriptionForecast(w http.ResponseWriter, req *http.Request) {
+	vars := req.URL.Query()
+
+	f, err := parseFilter(vars)
+	if err != nil {
+		s.LogError("filter format is wrong", "SubscriptionForecast", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+
+	months := DefaultForecastMonths
+	if v := vars.Get("months"); v != "" {
+		months, err = strconv.Atoi(v)
+		if err != nil || months <= 0 || months > MaxForecastMonths {
+			s.LogError("months format is wrong", "SubscriptionForecast", err, vars)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "months must be an integer from 1 to 120"))
+			return
+		}
+	}
+
+	// сценарий: отток в % в месяц, рост цен в % в год
+	churn, err := parsePercent(vars.Get("churn_rate"))
+	if err != nil || churn > 100 {
+		s.LogError("churn_rate format is wrong", "SubscriptionForecast", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, "churn_rate must be a percentage from 0 to 100"))
+		return
+	}
+	inflation, err := parsePercent(vars.Get("inflation"))
+	if err != nil {
+		s.LogError("inflation format is wrong", "SubscriptionForecast", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, "inflation must be a non-negative percentage"))
+		return
+	}
+	scenario := churn > 0 || inflation > 0
+
+	// прогноз начинается со следующего месяца, учитываются только действующие подписки
+	start := utils.MonthStart(time.Now()).AddDate(0, 1, 0)
+	end := start.AddDate(0, months-1, 0)
+	f.Start, f.End = &start, &end
+
+	points, err := s.repo.SubscriptionTimeSeries(req.Context(), f)
+	if err != nil {
+		s.LogError("DB forecast error", "SubscriptionForecast", err, vars)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	resp := &ForecastResponse{}
+	resp.Points = make([]ForecastPoint, 0, len(points))
+	for i, p := range points {
+		var point ForecastPoint
+		point.Month = p.Month.Format(DateFormat)
+		point.Total = p.Total
+		point.Count = p.Count
+		resp.Total += p.Total
+		if scenario {
+			k := float64(i + 1)
+			v := float64(p.Total) * math.Pow(1-churn/100, k) * math.Pow(1+inflation/100, k/12)
+			value := uint(math.Round(v))
+			point.Scenario = &value
+			resp.ScenarioTotal += value
+		}
+		resp.Points = append(resp.Points, point)
+	}
+	if scenario {
+		resp.ChurnRate = &churn
+		resp.Inflation = &inflation
+	}
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "SubscriptionForecast", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// период аналитики по умолчанию: последние 12 месяцев
+func analyticsPeriod(f *model.Filter) error {
+	if f.End == nil {
+		end := utils.MonthStart(time.Now())
+		f.End = &end
+	}
+	if f.Start == nil {
+		start := f.End.AddDate(0, -11, 0)
+		f.Start = &start
+	}
+	months := utils.MonthsBetween(*f.Start, *f.End)
+	if months <= 0 || months > MaxSeriesMonths {
+		return errors.New("end_date must not be before start_date, period is limited to 600 months")
+	}
+	return nil
+}
+
+// Churn
+func (s *Server) SubscriptionChurn(w http.ResponseWriter, req *http.Request) {
+	vars := req.URL.Query()
+
+	f, err := parseFilter(vars)
+	if err == nil {
+		err = analyticsPeriod(&f)
+	}
+	if err != nil {
+		s.LogError("filter format is wrong", "SubscriptionChurn", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+
+	points, err := s.repo.SubscriptionChurn(req.Context(), f)
+	if err != nil {
+		s.LogError("DB churn error", "SubscriptionChurn", err, vars)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	// строки отсортированы по сервису и месяцу, итог - сумма по сервисам
+	resp := &ChurnResponse{}
+	resp.Services = make([]ChurnService, 0)
+	totals := make([]model.ChurnPoint, utils.MonthsBetween(*f.Start, *f.End))
+	for i := range totals {
+		totals[i].Month = f.Start.AddDate(0, i, 0)
+	}
+	for _, p := range points {
+		n := len(resp.Services)
+		if n == 0 || resp.Services[n-1].ServiceName != p.ServiceName {
+			resp.Services = append(resp.Services, ChurnService{ServiceName: p.ServiceName, Points: make([]ChurnPointResponse, 0)})
+			n++
+		}
+		resp.Services[n-1].Points = append(resp.Services[n-1].Points, churnPointResponse(p))
+
+		i := utils.MonthsBetween(*f.Start, p.Month) - 1
+		if i >= 0 && i < len(totals) {
+			totals[i].New += p.New
+			totals[i].Churned += p.Churned
+			totals[i].Active += p.Active
+		}
+	}
+	resp.Total = make([]ChurnPointResponse, 0, len(totals))
+	for _, p := range totals {
+		resp.Total = append(resp.Total, churnPointResponse(p))
+	}
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "SubscriptionChurn", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// кол-во периодов удержания по умолчанию и максимальное, месяцев
+const (
+	DefaultRetentionPeriods = 12
+	MaxRetentionPeriods     = 120
+)
+
+// Retention
+func (s *Server) SubscriptionRetention(w http.ResponseWriter, req *http.Request) {
+	vars := req.URL.Query()
+
+	// диапазон когорт: месяцы начала подписок
+	var f model.Filter
+	f.ServiceName = vars.Get("service_name")
+	if v := vars.Get("cohort_start"); v != "" {
+		start, err := utils.ParseDate(v, DateFormat)
+		if err != nil {
+			s.LogError("cohort_start format is wrong", "SubscriptionRetention", err, vars)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "cohort_start format is wrong"))
+			return
+		}
+		f.Start = &start
+	}
+	if v := vars.Get("cohort_end"); v != "" {
+		end, err := utils.ParseDate(v, DateFormat)
+		if err != nil {
+			s.LogError("cohort_end format is wrong", "SubscriptionRetention", err, vars)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "cohort_end format is wrong"))
+			return
+		}
+		f.End = &end
+	}
+	err := analyticsPeriod(&f)
+	if err != nil {
+		s.LogError("cohort range is wrong", "SubscriptionRetention", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+
+	periods := DefaultRetentionPeriods
+	if v := vars.Get("periods"); v != "" {
+		periods, err = strconv.Atoi(v)
+		if err != nil || periods <= 0 || periods > MaxRetentionPeriods {
+			s.LogError("periods format is wrong", "SubscriptionRetention", err, vars)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "periods must be an integer from 1 to 120"))
+			return
+		}
+	}
+
+	format := vars.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		s.LogError("format is wrong", "SubscriptionRetention", nil, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, "format must be json or csv"))
+		return
+	}
+
+	cohorts, err := s.repo.SubscriptionRetention(req.Context(), f, periods)
+	if err != nil {
+		s.LogError("DB retention error", "SubscriptionRetention", err, vars)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	resp := &RetentionResponse{}
+	resp.Periods = periods
+	resp.Cohorts = make([]RetentionCohort, 0, len(cohorts))
+	for _, c := range cohorts {
+		resp.Cohorts = append(resp.Cohorts, retentionCohort(c))
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="retention.csv"`)
+		w.WriteHeader(http.StatusOK)
+		err = writeRetentionCSV(w, resp)
+		if err != nil {
+			s.LogError("CSV write error", "SubscriptionRetention", err, nil)
+		}
+		return
+	}
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "SubscriptionRetention", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// треугольник удержания в CSV: cohort, size, затем кол-во и % для каждого периода
+func writeRetentionCSV(w io.Writer, resp *RetentionResponse) error {
+	cw := csv.NewWriter(w)
+
+	header := make([]string, 0, 2+resp.Periods*2)
+	header = append(header, "cohort", "size")
+	for k := 1; k <= resp.Periods; k++ {
+		header = append(header, fmt.Sprintf("month_%d", k), fmt.Sprintf("month_%d_pct", k))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, c := range resp.Cohorts {
+		row := make([]string, 0, len(header))
+		row = append(row, c.Cohort, strconv.Itoa(c.Size))
+		for k := 0; k < resp.Periods; k++ {
+			// ненаступившие месяцы - пустые ячейки
+			if k < len(c.Retention) {
+				row = append(row, strconv.Itoa(c.Retention[k].Count), strconv.FormatFloat(c.Retention[k].Percent, 'f', 2, 64))
+			} else {
+				row = append(row, "", "")
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// MRR
+func (s *Server) SubscriptionMRR(w http.ResponseWriter, req *http.Request) {
+	vars := req.URL.Query()
+
+	f, err := parseFilter(vars)
+	if err == nil {
+		err = analyticsPeriod(&f)
+	}
+	if err != nil {
+		s.LogError("filter format is wrong", "SubscriptionMRR", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+
+	points, err := s.repo.SubscriptionMRR(req.Context(), f)
+	if err != nil {
+		s.LogError("DB MRR error", "SubscriptionMRR", err, vars)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	resp := &MRRResponse{}
+	resp.Points = make([]MRRPointResponse, 0, len(points))
+	for _, p := range points {
+		var point MRRPointResponse
+		point.Month = p.Month.Format(DateFormat)
+		point.MRR = p.MRR
+		point.New = p.New
+		point.Expansion = p.Expansion
+		point.Contraction = p.Contraction
+		point.Churned = p.Churned
+		point.NetChange = int64(p.New) + int64(p.Expansion) - int64(p.Contraction) - int64(p.Churned)
+		resp.Points = append(resp.Points, point)
+	}
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "SubscriptionMRR", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// Service Stats
+func (s *Server) ServiceStats(w http.ResponseWriter, req *http.Request) {
+	vars := req.URL.Query()
+
+	f, err := parseFilter(vars)
+	if err != nil {
+		s.LogError("filter format is wrong", "ServiceStats", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+	f.UserId = uuid.Nil
+	f.ServiceName = mux.Vars(req)["name"]
+
+	stats, err := s.repo.SubscriptionPriceStats(req.Context(), f)
+	if err != nil {
+		s.LogError("DB price stats error", "ServiceStats", err, f)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	// динамика за период фильтра, по умолчанию - последние 12 месяцев
+	hf := f
+	err = analyticsPeriod(&hf)
+	if err != nil {
+		s.LogError("period is wrong", "ServiceStats", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+	history, err := s.repo.SubscriptionPriceHistory(req.Context(), hf)
+	if err != nil {
+		s.LogError("DB price history error", "ServiceStats", err, f)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	resp := &ServiceStatsResponse{}
+	resp.ServiceName = f.ServiceName
+	resp.PriceStatsResponse = priceStatsResponse(*stats)
+	resp.History = make([]PriceStatsResponse, 0, len(history))
+	for _, h := range history {
+		resp.History = append(resp.History, priceStatsResponse(h))
+	}
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "ServiceStats", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
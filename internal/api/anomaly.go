@@ -0,0 +1,108 @@
+package emsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+)
+
+// Anomalies
+func (s *Server) SubscriptionAnomalies(w http.ResponseWriter, req *http.Request) {
+	vars := req.URL.Query()
+
+	f, err := parseFilter(vars)
+	if err != nil {
+		s.LogError("filter format is wrong", "SubscriptionAnomalies", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+	limit, _ := strconv.Atoi(vars.Get("limit"))
+	offset, _ := strconv.Atoi(vars.Get("offset"))
+	if limit < 0 || offset < 0 {
+		s.LogError("limit or offset is wrong", "SubscriptionAnomalies", nil, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, "limit and offset must not be negative"))
+		return
+	}
+
+	// множитель размаха можно переопределить в запросе
+	k := s.config.AnomalyIQR
+	if str := vars.Get("k"); str != "" {
+		k, err = strconv.ParseFloat(str, 64)
+		if err != nil || k <= 0 {
+			s.LogError("k format is wrong", "SubscriptionAnomalies", err, vars)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "k must be a positive number"))
+			return
+		}
+	}
+	if k <= 0 {
+		s.LogError("anomaly detection is disabled", "SubscriptionAnomalies", nil, vars)
+		s.writeError(w, req, NewError(CodeNotFound, "anomaly detection is disabled"))
+		return
+	}
+
+	anomalies, err := s.repo.SubscriptionAnomalies(req.Context(), f, k, s.config.AnomalyMinSamples, limit, offset)
+	if err != nil {
+		s.LogError("DB anomalies error", "SubscriptionAnomalies", err, vars)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	resp := &AnomalyListResponse{}
+	resp.Data = make([]AnomalyResponse, 0, len(anomalies))
+	for _, a := range anomalies {
+		resp.Data = append(resp.Data, anomalyResponse(a))
+	}
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "SubscriptionAnomalies", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// предупреждения по цене сохраненной подписки, ошибки проверки не мешают записи.
+// Сама подписка в расчет границ не входит, иначе она сдвигает их к своей цене
+func (s *Server) priceWarnings(ctx context.Context, sub model.Subscription) []string {
+	if s.config.AnomalyIQR <= 0 {
+		return nil
+	}
+	b, err := s.repo.SubscriptionPriceBounds(ctx, sub.ServiceName, sub.Id, s.config.AnomalyIQR)
+	if err != nil {
+		if !errors.Is(err, model.ErrNotFound) {
+			s.LogError("DB price bounds error", "priceWarnings", err, sub)
+		}
+		return nil
+	}
+	if b.Count < s.config.AnomalyMinSamples || !b.Outlier(sub.Price) {
+		return nil
+	}
+	return []string{fmt.Sprintf("price %d is unusual for %s: median %.0f, expected range %.0f-%.0f",
+		sub.Price, sub.ServiceName, b.Median, max(b.Low, 0), b.High)}
+}
+
+// ответ на изменение подписки: тело только при наличии предупреждений
+func (s *Server) writeWarnings(w http.ResponseWriter, req *http.Request, service string, warnings []string) {
+	if len(warnings) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	r, err := json.Marshal(&SubscriptionWarningResponse{Warnings: warnings})
+	if err != nil {
+		s.LogError("JSON marshal error", service, err, warnings)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"time"
@@ -12,32 +13,75 @@ import (
 	interfaces "github.com/glkeru/EM_Subscriptions/internal/interfaces"
 	model "github.com/glkeru/EM_Subscriptions/internal/model"
 	utils "github.com/glkeru/EM_Subscriptions/internal/utils"
+	validate "github.com/glkeru/EM_Subscriptions/internal/validate"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
 type Server struct {
-	router *mux.Router
-	repo   interfaces.RepoSubcription
-	logger *zap.Logger
-	config *config.Config
+	router  *mux.Router
+	repo    interfaces.Repository
+	budgets interfaces.Budgets
+	events  interfaces.Events
+	logger  *zap.Logger
+	config  *config.Config
+	graphql *graphqlExecutor
 }
 
-func NewServer(repo interfaces.RepoSubcription, logger *zap.Logger, c *config.Config) (*Server, error) {
+func NewServer(repo interfaces.Repository, budgets interfaces.Budgets, events interfaces.Events, logger *zap.Logger, c *config.Config) (*Server, error) {
 	router := mux.NewRouter().StrictSlash(true)
 	router.Use(MiddlewareLog(logger, c))
-	server := &Server{router, repo, logger, c}
+	server := &Server{router: router, repo: repo, budgets: budgets, events: events, logger: logger, config: c}
+	// middleware роутера не вызываются для ненайденных маршрутов
+	router.NotFoundHandler = MiddlewareLog(logger, c)(http.HandlerFunc(server.NotFound))
+	router.MethodNotAllowedHandler = MiddlewareLog(logger, c)(http.HandlerFunc(server.MethodNotAllowed))
 
 	router.HandleFunc("/api/v1/subscription", server.SubscriptionPing).Methods(http.MethodHead)
-	router.HandleFunc("/api/v1/subscription", server.SubscriptionCreate).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/subscription", server.Idempotent(server.SubscriptionCreate)).Methods(http.MethodPost)
 	router.HandleFunc("/api/v1/subscription/{id}", server.SubscriptionRead).Methods(http.MethodGet)
 	router.HandleFunc("/api/v1/subscription", server.SubscriptionList).Methods(http.MethodGet)
 	router.HandleFunc("/api/v1/subscription/{id}", server.SubscriptionUpdate).Methods(http.MethodPut)
 	router.HandleFunc("/api/v1/subscription/{id}", server.SubscriptionPatch).Methods(http.MethodPatch)
 	router.HandleFunc("/api/v1/subscription/{id}", server.SubscriptionDelete).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/import/csv", server.SubscriptionImportCSV).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/export", server.SubscriptionExport).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/events", server.SubscriptionEvents).Methods(http.MethodGet)
 
 	router.HandleFunc("/api/v1/total", server.SubscriptionTotal).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/compare", server.SubscriptionCompare).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/timeseries", server.SubscriptionTimeSeries).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/forecast", server.SubscriptionForecast).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/analytics/churn", server.SubscriptionChurn).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/analytics/retention", server.SubscriptionRetention).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/analytics/mrr", server.SubscriptionMRR).Methods(http.MethodGet)
+
+	router.HandleFunc("/api/v1/budgets", server.Idempotent(server.BudgetCreate)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/budgets", server.BudgetList).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/budgets/{id}", server.BudgetRead).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/budgets/{id}", server.BudgetUpdate).Methods(http.MethodPut)
+	router.HandleFunc("/api/v1/budgets/{id}", server.BudgetDelete).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/budgets/{id}/status", server.BudgetStatus).Methods(http.MethodGet)
+
+	router.HandleFunc("/api/v1/services/{name}/stats", server.ServiceStats).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/anomalies", server.SubscriptionAnomalies).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/users/{id}/recommendations", server.UserRecommendations).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/users/{id}/report", server.UserReport).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/users/{id}/calendar.ics", server.CalendarFeed).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/users/{id}/calendar/token", server.CalendarTokenCreate).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/users/{id}/calendar/token", server.CalendarTokenDelete).Methods(http.MethodDelete)
+
+	var err error
+	server.graphql, err = newGraphQL(server)
+	if err != nil {
+		return nil, err
+	}
+	router.HandleFunc("/graphql", server.GraphQL).Methods(http.MethodPost)
+
+	router.HandleFunc("/api/v1/categories", server.CategoryList).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/services/{name}/category", server.CategoryRead).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/services/{name}/category", server.CategorySet).Methods(http.MethodPut)
+	router.HandleFunc("/api/v1/services/{name}/category", server.CategoryDelete).Methods(http.MethodDelete)
 
 	return server, nil
 }
@@ -60,12 +104,23 @@ func (s *Server) LogError(msg, service string, err error, data any) {
 	)
 }
 
+// проверка обязательных полей и разбор дат подписки из запроса
+func subscriptionModel(subreq SubscriptionFull, layout string) (*model.Subscription, error) {
+	return validate.Subscription(validate.SubscriptionInput{
+		ServiceName: subreq.ServiceName,
+		UserId:      subreq.UserId,
+		Price:       uint64(subreq.Price),
+		StartDate:   subreq.StartDate,
+		EndDate:     subreq.EndDate,
+	}, layout)
+}
+
 // Create
 func (s *Server) SubscriptionCreate(w http.ResponseWriter, req *http.Request) {
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
 		s.LogError("get request body", "SubscriptionCreate", err, nil)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
 		return
 	}
 	defer req.Body.Close()
@@ -74,57 +129,39 @@ func (s *Server) SubscriptionCreate(w http.ResponseWriter, req *http.Request) {
 	err = json.Unmarshal(body, subreq)
 	if err != nil {
 		s.LogError("get JSON body", "SubscriptionCreate", err, string(body))
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
 		return
 	}
 
-	// обязательность полей
-	if subreq.ServiceName == "" || subreq.Price <= 0 || subreq.UserId == uuid.Nil || subreq.StartDate == "" {
-		s.LogError("missing required fields", "SubscriptionCreate", err, subreq)
-		http.Error(w, "missing required fields, required: service_name, user_id, pruce, start_date", http.StatusBadRequest)
-		return
-	}
-
-	// парсинг json
-	subs := &model.Subscription{}
-	subs.ServiceName = subreq.ServiceName
-	subs.UserId = subreq.UserId
-	subs.Price = subreq.Price
-	subs.StartDate, err = utils.ParseDate(subreq.StartDate, DateFormat)
+	subs, err := subscriptionModel(*subreq, DateFormat)
 	if err != nil {
-		s.LogError("start_date parsing error", "SubscriptionCreate", err, subs.StartDate)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.LogError("subscription validation error", "SubscriptionCreate", err, subreq)
+		s.writeError(w, req, NewError(CodeValidationFailed, err.Error()))
 		return
 	}
-	if subreq.EndDate != "" {
-		dt, err := utils.ParseDate(subreq.EndDate, DateFormat)
-		if err != nil {
-			s.LogError("end_date parsing error", "SubscriptionCreate", err, subs.EndDate)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		subs.EndDate = &dt
-	}
 
 	id, err := s.repo.SubscriptionCreate(req.Context(), *subs)
 	if err != nil {
 		s.LogError("DB create subscription", "SubscriptionCreate", err, subs)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, req, ErrInternal)
 		return
 	}
 
+	subs.Id = id
+
 	subresp := &SubscriptionCreateResponse{}
 	subresp.Id = id
+	subresp.Warnings = s.priceWarnings(req.Context(), *subs)
 
 	r, err := json.Marshal(subresp)
 	if err != nil {
 		s.LogError("JSON marshal error", "SubscriptionCreate", err, subresp)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, req, ErrInternal)
 		return
 	}
-	w.Write(r)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	w.Write(r)
 }
 
 // Read
@@ -133,7 +170,7 @@ func (s *Server) SubscriptionRead(w http.ResponseWriter, req *http.Request) {
 	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		s.LogError("ID parse error", "SubscriptionRead", err, vars["id"])
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, req, ErrInvalidId)
 		return
 	}
 
@@ -142,12 +179,12 @@ func (s *Server) SubscriptionRead(w http.ResponseWriter, req *http.Request) {
 
 		if errors.Is(err, model.ErrNotFound) {
 			s.LogError("Subscription not found", "SubscriptionRead", err, id)
-			http.Error(w, "Subscription not found", http.StatusNotFound)
+			s.writeError(w, req, NewError(CodeNotFound, "Subscription not found"))
 			return
 		}
 
 		s.LogError("DB read subscription", "SubscriptionRead", err, id)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, req, ErrInternal)
 		return
 	}
 
@@ -164,7 +201,7 @@ func (s *Server) SubscriptionRead(w http.ResponseWriter, req *http.Request) {
 	r, err := json.Marshal(subresp)
 	if err != nil {
 		s.LogError("JSON marshal error", "SubscriptionRead", err, subresp)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, req, ErrInternal)
 		return
 	}
 
@@ -180,14 +217,14 @@ func (s *Server) SubscriptionUpdate(w http.ResponseWriter, req *http.Request) {
 	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		s.LogError("ID parse error", "SubscriptionUpdate", err, vars["id"])
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, req, ErrInvalidId)
 		return
 	}
 
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
 		s.LogError("get request body", "SubscriptionUpdate", err, nil)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
 		return
 	}
 	defer req.Body.Close()
@@ -197,53 +234,33 @@ func (s *Server) SubscriptionUpdate(w http.ResponseWriter, req *http.Request) {
 	err = json.Unmarshal(body, subreq)
 	if err != nil {
 		s.LogError("get JSON body", "SubscriptionUpdate", err, string(body))
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
 		return
 	}
 
-	// обязательность полей
-	if subreq.ServiceName == "" || subreq.Price <= 0 || subreq.UserId == uuid.Nil || subreq.StartDate == "" {
-		s.LogError("missing required fields", "SubscriptionCreate", err, subreq)
-		http.Error(w, "missing required fields", http.StatusBadRequest)
-		return
-	}
-
-	subs := &model.Subscription{}
-	subs.Id = id
-	subs.ServiceName = subreq.ServiceName
-	subs.UserId = subreq.UserId
-	subs.Price = subreq.Price
-	subs.StartDate, err = utils.ParseDate(subreq.StartDate, DateFormat)
+	subs, err := subscriptionModel(*subreq, DateFormat)
 	if err != nil {
-		s.LogError("start_date parsing error", "SubscriptionUpdate", err, subs.StartDate)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.LogError("subscription validation error", "SubscriptionUpdate", err, subreq)
+		s.writeError(w, req, NewError(CodeValidationFailed, err.Error()))
 		return
 	}
-	if subreq.EndDate != "" {
-		dt, err := utils.ParseDate(subreq.EndDate, DateFormat)
-		if err != nil {
-			s.LogError("end_date parsing error", "SubscriptionUpdate", err, subs.EndDate)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		subs.EndDate = &dt
-	}
+	subs.Id = id
 
 	err = s.repo.SubscriptionUpdate(req.Context(), *subs)
 	if err != nil {
 
 		if errors.Is(err, model.ErrNotFound) {
 			s.LogError("Subscription not found", "SubscriptionUpdate", err, id)
-			http.Error(w, "Subscription not found", http.StatusNotFound)
+			s.writeError(w, req, NewError(CodeNotFound, "Subscription not found"))
 			return
 		}
 
 		s.LogError("DB update error", "SubscriptionUpdate", err, subs)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, req, ErrInternal)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	s.writeWarnings(w, req, "SubscriptionUpdate", s.priceWarnings(req.Context(), *subs))
 }
 
 // Update (PATCH)
@@ -253,97 +270,96 @@ func (s *Server) SubscriptionPatch(w http.ResponseWriter, req *http.Request) {
 	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		s.LogError("ID parse error", "SubscriptionPatch", err, vars["id"])
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, req, ErrInvalidId)
 		return
 	}
 
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
 		s.LogError("get request body", "SubscriptionPatch", err, nil)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
 		return
 	}
 	defer req.Body.Close()
 
-	// парсинг json
-	fields := make(map[string]any)
-	err = json.Unmarshal(body, &fields)
-	if err != nil || len(fields) == 0 {
-		s.LogError("get JSON body", "SubscriptionPatch", err, string(body))
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	// проверим user_id и service_name
-	if v, ok := fields["user_id"]; ok {
-		if v == "" {
-			s.LogError("user_id is required", "SubscriptionPatch", err, nil)
-			http.Error(w, "user_id is required", http.StatusBadRequest)
-			return
-		}
-	}
-	if v, ok := fields["service_name"]; ok {
-		if v == "" {
-			s.LogError("service_name is required", "SubscriptionPatch", err, v)
-			http.Error(w, "service_name is required", http.StatusBadRequest)
+	// тип патча определяется по Content-Type
+	var patch model.SubscriptionPatch
+	ctype, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch ctype {
+	case ContentTypeJSONPatch:
+		ops := make([]jsonPatchOp, 0)
+		err = json.Unmarshal(body, &ops)
+		if err != nil || len(ops) == 0 {
+			s.LogError("get JSON Patch body", "SubscriptionPatch", err, string(body))
+			s.writeError(w, req, NewError(CodeInvalidBody, "request body must be a non-empty JSON Patch array"))
 			return
 		}
-	}
-	if v, ok := fields["price"]; ok {
-		if v == "" {
-			s.LogError("price is required", "SubscriptionPatch", err, v)
-			http.Error(w, "price is required", http.StatusBadRequest)
+
+		// операции применяются к подписке под блокировкой строки: test проверяется
+		// по актуальному состоянию, параллельные изменения не теряются
+		var patchErr error
+		err = s.repo.SubscriptionPatchWith(req.Context(), id, func(sub model.Subscription) (model.SubscriptionPatch, error) {
+			diff, err := applyJSONPatch(sub, ops)
+			if err == nil {
+				patch, err = parseMergePatch(diff)
+			}
+			patchErr = err
+			return patch, err
+		})
+		if patchErr != nil {
+			s.LogError("JSON Patch apply error", "SubscriptionPatch", patchErr, string(body))
+			s.writeError(w, req, NewError(CodeUnprocessable, patchErr.Error()))
 			return
 		}
-	}
 
-	// парсим дату начала
-	if v, ok := fields["start_date"]; ok {
-		str, ok := v.(string)
-		if !ok {
-			s.LogError("start_date parsing error", "SubscriptionPatch", err, v)
-			http.Error(w, "start_date parsing error", http.StatusBadRequest)
+	case ContentTypeMergePatch, "application/json", "":
+		fields := make(map[string]json.RawMessage)
+		err = json.Unmarshal(body, &fields)
+		if err != nil || len(fields) == 0 {
+			s.LogError("get JSON body", "SubscriptionPatch", err, string(body))
+			s.writeError(w, req, NewError(CodeInvalidBody, "request body must be a non-empty JSON object"))
 			return
 		}
-		start, err := utils.ParseDate(str, DateFormat)
+		patch, err = parseMergePatch(fields)
 		if err != nil {
-			s.LogError("start_date parsing error", "SubscriptionPatch", err, v.(string))
-			http.Error(w, "start_date parsing error", http.StatusBadRequest)
+			s.LogError("merge patch validation error", "SubscriptionPatch", err, string(body))
+			s.writeError(w, req, NewError(CodeValidationFailed, err.Error()))
 			return
 		}
-		fields["start_date"] = start
-	}
-	// парсим дату окончания
-	if v, ok := fields["end_date"]; ok {
-		str, ok := v.(string)
-		if !ok {
-			s.LogError("end_date parsing error", "SubscriptionPatch", err, v)
-			http.Error(w, "end_date parsing error", http.StatusBadRequest)
-			return
 
-		}
-		end, err := utils.ParseDate(str, DateFormat)
-		if err != nil {
-			s.LogError("end_date parsing error", "SubscriptionPatch", err, v.(string))
-			http.Error(w, "end_date parsing error", http.StatusBadRequest)
-			return
-		}
-		fields["end_date"] = end
-	}
+		err = s.repo.SubscriptionPatch(req.Context(), id, patch)
 
-	err = s.repo.SubscriptionPatch(req.Context(), id, fields)
+	default:
+		s.LogError("unsupported content type", "SubscriptionPatch", nil, ctype)
+		s.writeError(w, req, NewError(CodeUnsupportedMediaType, "unsupported content type, expected "+ContentTypeMergePatch+" or "+ContentTypeJSONPatch))
+		return
+	}
 	if err != nil {
 		if errors.Is(err, model.ErrNotFound) {
 			s.LogError("Subscription not found", "SubscriptionPatch", err, id)
-			http.Error(w, "Subscription not found", http.StatusNotFound)
+			s.writeError(w, req, NewError(CodeNotFound, "Subscription not found"))
 			return
 		}
 		s.LogError("DB update error", "SubscriptionPatch", err, id)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, req, ErrInternal)
 		return
 	}
-
-	w.WriteHeader(http.StatusOK)
+	// ничего не изменилось (например, только test)
+	if patch.Empty() {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// цена проверяется, только если поменялась цена или сервис
+	var warnings []string
+	if patch.Price != nil || patch.ServiceName != nil {
+		sub, err := s.repo.SubscriptionRead(req.Context(), id)
+		if err != nil {
+			s.LogError("DB read subscription", "SubscriptionPatch", err, id)
+		} else {
+			warnings = s.priceWarnings(req.Context(), *sub)
+		}
+	}
+	s.writeWarnings(w, req, "SubscriptionPatch", warnings)
 }
 
 // Delete
@@ -352,7 +368,7 @@ func (s *Server) SubscriptionDelete(w http.ResponseWriter, req *http.Request) {
 	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		s.LogError("ID parse error", "SubscriptionDelete", err, vars["id"])
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, req, ErrInvalidId)
 		return
 	}
 
@@ -360,12 +376,12 @@ func (s *Server) SubscriptionDelete(w http.ResponseWriter, req *http.Request) {
 	if err != nil {
 		if errors.Is(err, model.ErrNotFound) {
 			s.LogError("Subscription not found", "SubscriptionDelete", err, id)
-			http.Error(w, "Subscription not found", http.StatusNotFound)
+			s.writeError(w, req, NewError(CodeNotFound, "Subscription not found"))
 			return
 		}
 
 		s.LogError("DB delete subscription", "SubscriptionDelete", err, id)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, req, ErrInternal)
 		return
 	}
 
@@ -383,12 +399,19 @@ func (s *Server) SubscriptionList(w http.ResponseWriter, req *http.Request) {
 	var offset int
 	var err error
 
+	format, err := exportFormat(req)
+	if err != nil {
+		s.LogError("format is wrong", "SubscriptionList", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+
 	strid := vars.Get("user_id")
 	if strid != "" {
 		user, err = uuid.Parse(strid)
 		if err != nil {
 			s.LogError("user_id format is wrong", "SubscriptionList", err, nil)
-			http.Error(w, "user_id format is wrong", http.StatusBadRequest)
+			s.writeError(w, req, NewError(CodeInvalidId, "user_id format is wrong"))
 			return
 		}
 	}
@@ -401,7 +424,7 @@ func (s *Server) SubscriptionList(w http.ResponseWriter, req *http.Request) {
 		startdate, err := utils.ParseDate(strid, DateFormat)
 		if err != nil {
 			s.LogError("start_date format is wrong", "SubscriptionList", err, nil)
-			http.Error(w, "start_date format is wrong", http.StatusBadRequest)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "start_date format is wrong"))
 			return
 		}
 		start = &startdate
@@ -411,16 +434,43 @@ func (s *Server) SubscriptionList(w http.ResponseWriter, req *http.Request) {
 		enddate, err := utils.ParseDate(strid, DateFormat)
 		if err != nil {
 			s.LogError("end_date format is wrong", "SubscriptionList", err, nil)
-			http.Error(w, "end_date format is wrong", http.StatusBadRequest)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "end_date format is wrong"))
 			return
 		}
 		end = &enddate
 	}
 
-	subs, err := s.repo.SubscriptionList(req.Context(), user, service, start, end, limit, offset)
+	f := model.Filter{UserId: user, ServiceName: service, Start: start, End: end}
+	f.Expr, err = parseFilterExpr(vars)
+	if err != nil {
+		s.LogError("filter is wrong", "SubscriptionList", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+
+	var opts model.ListOptions
+	opts.Sort, err = parseSort(vars)
+	if err != nil {
+		s.LogError("sort is wrong", "SubscriptionList", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+	opts.Fields, err = parseFields(vars)
+	if err != nil {
+		s.LogError("fields is wrong", "SubscriptionList", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+
+	subs, err := s.repo.SubscriptionList(req.Context(), f, limit, offset, opts)
 	if err != nil {
 		s.LogError("DB list error", "SubscriptionList", err, vars)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	if format != FormatJSON {
+		s.writeSubscriptionsTable(w, req, format, subs, f, opts.Fields)
 		return
 	}
 
@@ -435,6 +485,25 @@ func (s *Server) SubscriptionList(w http.ResponseWriter, req *http.Request) {
 	}
 
 	resp.Offset = offset
+
+	// только запрошенные поля в порядке fields
+	if len(opts.Fields) > 0 {
+		fresp := &SubscriptionFieldsListResponse{resp.Limit, resp.Offset, make([]SubscriptionFields, 0, lensub)}
+		for _, v := range subs {
+			fresp.Data = append(fresp.Data, SubscriptionFields{opts.Fields, subscriptionColumns(v, opts.Fields)})
+		}
+		r, err := json.Marshal(fresp)
+		if err != nil {
+			s.LogError("JSON marshal error", "SubscriptionList", err, fresp)
+			s.writeError(w, req, ErrInternal)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(r)
+		return
+	}
+
 	for _, v := range subs {
 		var rdata SubscriptionFull
 		rdata.Id = v.Id
@@ -451,7 +520,7 @@ func (s *Server) SubscriptionList(w http.ResponseWriter, req *http.Request) {
 	r, err := json.Marshal(resp)
 	if err != nil {
 		s.LogError("JSON marshal error", "SubscriptionList", err, resp)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.writeError(w, req, ErrInternal)
 		return
 	}
 
@@ -460,58 +529,87 @@ func (s *Server) SubscriptionList(w http.ResponseWriter, req *http.Request) {
 	w.Write(r)
 }
 
-// List
+// Total
 func (s *Server) SubscriptionTotal(w http.ResponseWriter, req *http.Request) {
 	vars := req.URL.Query()
-	var user uuid.UUID
-	var service string
-	var start *time.Time
-	var end *time.Time
-	var err error
 
-	strid := vars.Get("user_id")
-	if strid != "" {
-		user, err = uuid.Parse(strid)
+	format, err := exportFormat(req)
+	if err != nil {
+		s.LogError("format is wrong", "SubscriptionTotal", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+	f, err := parseFilter(vars)
+	if err != nil {
+		s.LogError("filter format is wrong", "SubscriptionTotal", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+	f.Expr, err = parseFilterExpr(vars)
+	if err != nil {
+		s.LogError("filter is wrong", "SubscriptionTotal", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+	groupBy, err := parseGroupBy(vars)
+	if err != nil {
+		s.LogError("group_by format is wrong", "SubscriptionTotal", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+
+	resp := &SubscriptionTotalResponse{}
+	var groups []model.TotalGroup
+	switch {
+	case vars.Get("explain") == "true":
+		// расшифровка по подпискам: итог, строки и группы из одного снимка без агрегата
+		var lines []model.TotalLine
+		lines, groups, err = s.repo.SubscriptionTotalExplain(req.Context(), f, groupBy)
 		if err != nil {
-			s.LogError("user_id format is wrong", "SubscriptionTotal", err, nil)
-			http.Error(w, "user_id format is wrong", http.StatusBadRequest)
+			s.LogError("DB total explain error", "SubscriptionTotal", err, vars)
+			s.writeError(w, req, ErrInternal)
 			return
 		}
-	}
-	service = vars.Get("service_name")
-	strid = vars.Get("start_date")
-	if strid != "" {
-		startdate, err := utils.ParseDate(strid, DateFormat)
+		resp.Lines = make([]TotalLineResponse, 0, len(lines))
+		for _, l := range lines {
+			resp.Price += l.Subtotal
+			resp.Lines = append(resp.Lines, totalLineResponse(l))
+		}
+	case len(groupBy) == 0:
+		resp.Price, err = s.repo.SubscriptionTotal(req.Context(), f)
 		if err != nil {
-			s.LogError("start_date format is wrong", "SubscriptionTotal", err, nil)
-			http.Error(w, "start_date format is wrong", http.StatusBadRequest)
+			s.LogError("DB total error", "SubscriptionTotal", err, vars)
+			s.writeError(w, req, ErrInternal)
 			return
 		}
-		start = &startdate
-	}
-	strid = vars.Get("end_date")
-	if strid != "" {
-		enddate, err := utils.ParseDate(strid, DateFormat)
+	default:
+		// разбивка одним запросом, итог - сумма по группам
+		groups, err = s.repo.SubscriptionTotalGroup(req.Context(), f, groupBy)
 		if err != nil {
-			s.LogError("end_date format is wrong", "SubscriptionTotal", err, nil)
-			http.Error(w, "end_date format is wrong", http.StatusBadRequest)
+			s.LogError("DB total group error", "SubscriptionTotal", err, vars)
+			s.writeError(w, req, ErrInternal)
 			return
 		}
-		end = &enddate
+		for _, g := range groups {
+			resp.Price += g.Total
+		}
+	}
+	if len(groupBy) > 0 {
+		resp.Groups = make([]TotalGroupResponse, 0, len(groups))
+		for _, g := range groups {
+			resp.Groups = append(resp.Groups, totalGroupResponse(g))
+		}
 	}
 
-	resp := &SubscriptionTotalResponse{}
-	resp.Price, err = s.repo.SubscriptionTotal(req.Context(), user, service, start, end)
-	if err != nil {
-		s.LogError("DB list error", "SubscriptionTotal", err, vars)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if format != FormatJSON {
+		s.writeTotalTable(w, req, format, resp, f)
 		return
 	}
 
 	r, err := json.Marshal(resp)
 	if err != nil {
 		s.LogError("JSON marshal error", "SubscriptionTotal", err, resp)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.writeError(w, req, ErrInternal)
 		return
 	}
 
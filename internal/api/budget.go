@@ -0,0 +1,285 @@
+package emsub
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	validate "github.com/glkeru/EM_Subscriptions/internal/validate"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Budget Create
+func (s *Server) BudgetCreate(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		s.LogError("get request body", "BudgetCreate", err, nil)
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
+		return
+	}
+	defer req.Body.Close()
+
+	budreq := &BudgetFull{}
+	err = json.Unmarshal(body, budreq)
+	if err != nil {
+		s.LogError("get JSON body", "BudgetCreate", err, string(body))
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
+		return
+	}
+
+	b, err := budgetModel(budreq)
+	if err != nil {
+		s.LogError("budget validation error", "BudgetCreate", err, budreq)
+		s.writeError(w, req, NewError(CodeValidationFailed, err.Error()))
+		return
+	}
+
+	id, err := s.repo.BudgetCreate(req.Context(), *b)
+	if err != nil {
+		s.LogError("DB create budget", "BudgetCreate", err, b)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	r, err := json.Marshal(&BudgetCreateResponse{Id: id})
+	if err != nil {
+		s.LogError("JSON marshal error", "BudgetCreate", err, id)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(r)
+}
+
+// Budget Read
+func (s *Server) BudgetRead(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		s.LogError("ID parse error", "BudgetRead", err, vars["id"])
+		s.writeError(w, req, ErrInvalidId)
+		return
+	}
+
+	b, err := s.repo.BudgetRead(req.Context(), id)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			s.LogError("Budget not found", "BudgetRead", err, id)
+			s.writeError(w, req, NewError(CodeNotFound, "Budget not found"))
+			return
+		}
+		s.LogError("DB read budget", "BudgetRead", err, id)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	r, err := json.Marshal(budgetFull(*b))
+	if err != nil {
+		s.LogError("JSON marshal error", "BudgetRead", err, b)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// Budget Update (PUT)
+func (s *Server) BudgetUpdate(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		s.LogError("ID parse error", "BudgetUpdate", err, vars["id"])
+		s.writeError(w, req, ErrInvalidId)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		s.LogError("get request body", "BudgetUpdate", err, nil)
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
+		return
+	}
+	defer req.Body.Close()
+
+	budreq := &BudgetFull{}
+	err = json.Unmarshal(body, budreq)
+	if err != nil {
+		s.LogError("get JSON body", "BudgetUpdate", err, string(body))
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
+		return
+	}
+
+	b, err := budgetModel(budreq)
+	if err != nil {
+		s.LogError("budget validation error", "BudgetUpdate", err, budreq)
+		s.writeError(w, req, NewError(CodeValidationFailed, err.Error()))
+		return
+	}
+	b.Id = id
+
+	err = s.repo.BudgetUpdate(req.Context(), *b)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			s.LogError("Budget not found", "BudgetUpdate", err, id)
+			s.writeError(w, req, NewError(CodeNotFound, "Budget not found"))
+			return
+		}
+		s.LogError("DB update budget", "BudgetUpdate", err, b)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Budget Delete
+func (s *Server) BudgetDelete(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		s.LogError("ID parse error", "BudgetDelete", err, vars["id"])
+		s.writeError(w, req, ErrInvalidId)
+		return
+	}
+
+	err = s.repo.BudgetDelete(req.Context(), id)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			s.LogError("Budget not found", "BudgetDelete", err, id)
+			s.writeError(w, req, NewError(CodeNotFound, "Budget not found"))
+			return
+		}
+		s.LogError("DB delete budget", "BudgetDelete", err, id)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Budget List
+func (s *Server) BudgetList(w http.ResponseWriter, req *http.Request) {
+	vars := req.URL.Query()
+	var user uuid.UUID
+	var err error
+
+	strid := vars.Get("user_id")
+	if strid != "" {
+		user, err = uuid.Parse(strid)
+		if err != nil {
+			s.LogError("user_id format is wrong", "BudgetList", err, nil)
+			s.writeError(w, req, NewError(CodeInvalidId, "user_id format is wrong"))
+			return
+		}
+	}
+	limit, _ := strconv.Atoi(vars.Get("limit"))
+	offset, _ := strconv.Atoi(vars.Get("offset"))
+	if limit < 0 || offset < 0 {
+		s.LogError("limit or offset is wrong", "BudgetList", nil, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, "limit and offset must not be negative"))
+		return
+	}
+
+	budgets, err := s.repo.BudgetList(req.Context(), user, limit, offset)
+	if err != nil {
+		s.LogError("DB list budgets", "BudgetList", err, vars)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	resp := &BudgetListResponse{}
+	resp.Data = make([]BudgetFull, 0, len(budgets))
+	for _, b := range budgets {
+		resp.Data = append(resp.Data, budgetFull(b))
+	}
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "BudgetList", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// Budget Status
+func (s *Server) BudgetStatus(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		s.LogError("ID parse error", "BudgetStatus", err, vars["id"])
+		s.writeError(w, req, ErrInvalidId)
+		return
+	}
+
+	b, err := s.repo.BudgetRead(req.Context(), id)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			s.LogError("Budget not found", "BudgetStatus", err, id)
+			s.writeError(w, req, NewError(CodeNotFound, "Budget not found"))
+			return
+		}
+		s.LogError("DB read budget", "BudgetStatus", err, id)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	st, err := s.budgets.Evaluate(req.Context(), *b)
+	if err != nil {
+		s.LogError("budget evaluation error", "BudgetStatus", err, id)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	r, err := json.Marshal(budgetStatusResponse(*st))
+	if err != nil {
+		s.LogError("JSON marshal error", "BudgetStatus", err, st)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// проверка и преобразование бюджета из запроса
+func budgetModel(req *BudgetFull) (*model.Budget, error) {
+	if req.UserId == uuid.Nil || req.Amount == 0 {
+		return nil, errors.New("missing required fields, required: user_id, amount")
+	}
+	if req.Amount > validate.MaxPrice {
+		return nil, errors.New("amount is too large")
+	}
+	if req.ServiceName != "" && req.Category != "" {
+		return nil, errors.New("budget can be limited either by service_name or by category")
+	}
+	if req.Threshold > 100 {
+		return nil, errors.New("threshold must be a percentage from 1 to 100")
+	}
+
+	b := &model.Budget{}
+	b.UserId = req.UserId
+	b.Amount = req.Amount
+	if req.ServiceName != "" {
+		b.ServiceName = &req.ServiceName
+	}
+	if req.Category != "" {
+		b.Category = &req.Category
+	}
+	if req.Threshold != 0 {
+		b.Threshold = &req.Threshold
+	}
+	return b, nil
+}
@@ -0,0 +1,188 @@
+package emsub
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	utils "github.com/glkeru/EM_Subscriptions/internal/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// длина токена календаря, байт
+const calendarTokenSize = 32
+
+// Calendar token (создание или замена)
+func (s *Server) CalendarTokenCreate(w http.ResponseWriter, req *http.Request) {
+	user, err := uuid.Parse(mux.Vars(req)["id"])
+	if err != nil || user == uuid.Nil {
+		s.LogError("user_id format is wrong", "CalendarTokenCreate", err, mux.Vars(req)["id"])
+		s.writeError(w, req, NewError(CodeInvalidId, "user_id format is wrong"))
+		return
+	}
+
+	raw := make([]byte, calendarTokenSize)
+	_, err = rand.Read(raw)
+	if err != nil {
+		s.LogError("token generation error", "CalendarTokenCreate", err, nil)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	// в БД хранится только хеш
+	err = s.repo.CalendarTokenSet(req.Context(), user, calendarTokenHash(token))
+	if err != nil {
+		s.LogError("DB calendar token error", "CalendarTokenCreate", err, user)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	resp := &CalendarTokenResponse{}
+	resp.Token = token
+	resp.URL = "/api/v1/users/" + user.String() + "/calendar.ics?token=" + token
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "CalendarTokenCreate", err, nil)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(r)
+}
+
+// Calendar token (отзыв)
+func (s *Server) CalendarTokenDelete(w http.ResponseWriter, req *http.Request) {
+	user, err := uuid.Parse(mux.Vars(req)["id"])
+	if err != nil || user == uuid.Nil {
+		s.LogError("user_id format is wrong", "CalendarTokenDelete", err, mux.Vars(req)["id"])
+		s.writeError(w, req, NewError(CodeInvalidId, "user_id format is wrong"))
+		return
+	}
+
+	err = s.repo.CalendarTokenDelete(req.Context(), user)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			s.LogError("calendar token not found", "CalendarTokenDelete", err, user)
+			s.writeError(w, req, NewError(CodeNotFound, "Calendar token not found"))
+			return
+		}
+		s.LogError("DB calendar token error", "CalendarTokenDelete", err, user)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Calendar feed (iCalendar, RFC 5545)
+func (s *Server) CalendarFeed(w http.ResponseWriter, req *http.Request) {
+	// неверный пользователь и неверный токен неотличимы
+	user, err := uuid.Parse(mux.Vars(req)["id"])
+	token := req.URL.Query().Get("token")
+	if err != nil || token == "" {
+		s.writeError(w, req, NewError(CodeNotFound, "Calendar not found"))
+		return
+	}
+	hash, err := s.repo.CalendarTokenRead(req.Context(), user)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		s.LogError("DB calendar token error", "CalendarFeed", err, user)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+	if err != nil || subtle.ConstantTimeCompare([]byte(hash), []byte(calendarTokenHash(token))) != 1 {
+		s.LogError("calendar token mismatch", "CalendarFeed", nil, user)
+		s.writeError(w, req, NewError(CodeNotFound, "Calendar not found"))
+		return
+	}
+
+	// действующие сейчас и будущие подписки
+	month := utils.MonthStart(time.Now())
+	subs, err := s.listAll(req.Context(), user, "", &month, nil)
+	if err != nil {
+		s.LogError("DB list error", "CalendarFeed", err, user)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="subscriptions.ics"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(calendarICS(subs, time.Now())))
+}
+
+func calendarTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ежемесячные повторяющиеся события списаний, end_date - последнее списание (UNTIL)
+func calendarICS(subs []model.Subscription, now time.Time) string {
+	var ics icsBuilder
+	ics.line("BEGIN", "VCALENDAR")
+	ics.line("VERSION", "2.0")
+	ics.line("PRODID", "-//EM Subscriptions//Subscriptions calendar//RU")
+	ics.line("CALSCALE", "GREGORIAN")
+	ics.line("METHOD", "PUBLISH")
+	ics.line("X-WR-CALNAME", "Подписки")
+	ics.line("REFRESH-INTERVAL;VALUE=DURATION", "PT12H")
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, sub := range subs {
+		rrule := "FREQ=MONTHLY"
+		if sub.EndDate != nil {
+			rrule += ";UNTIL=" + sub.EndDate.Format("20060102")
+		}
+		ics.line("BEGIN", "VEVENT")
+		ics.line("UID", sub.Id.String()+"@emsub")
+		ics.line("DTSTAMP", stamp)
+		ics.line("DTSTART;VALUE=DATE", sub.StartDate.Format("20060102"))
+		ics.line("RRULE", rrule)
+		ics.line("SUMMARY", icsText(fmt.Sprintf("%s: %d ₽", sub.ServiceName, sub.Price)))
+		ics.line("DESCRIPTION", icsText(fmt.Sprintf("Списание по подписке %s: %d ₽ в месяц", sub.ServiceName, sub.Price)))
+		ics.line("TRANSP", "TRANSPARENT")
+		ics.line("END", "VEVENT")
+	}
+	ics.line("END", "VCALENDAR")
+	return ics.String()
+}
+
+// строки iCalendar: CRLF, перенос длинных строк по 75 байт без разрыва символов
+type icsBuilder struct {
+	strings.Builder
+}
+
+func (b *icsBuilder) line(name, value string) {
+	l := name + ":" + value
+	limit := 75
+	for len(l) > limit {
+		cut := limit
+		for !utf8.RuneStart(l[cut]) {
+			cut--
+		}
+		b.WriteString(l[:cut] + "\r\n ")
+		l = l[cut:]
+		// строка продолжения начинается с пробела
+		limit = 74
+	}
+	b.WriteString(l + "\r\n")
+}
+
+// экранирование TEXT
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
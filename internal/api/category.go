@@ -0,0 +1,120 @@
+package emsub
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/gorilla/mux"
+)
+
+// Category List
+func (s *Server) CategoryList(w http.ResponseWriter, req *http.Request) {
+	cats, err := s.repo.CategoryList(req.Context())
+	if err != nil {
+		s.LogError("DB list categories", "CategoryList", err, nil)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	resp := &CategoryListResponse{}
+	resp.Data = make([]CategoryFull, 0, len(cats))
+	for _, c := range cats {
+		resp.Data = append(resp.Data, CategoryFull{ServiceName: c.ServiceName, Category: c.Category})
+	}
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "CategoryList", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// Category Read
+func (s *Server) CategoryRead(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+
+	c, err := s.repo.CategoryRead(req.Context(), name)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			s.LogError("Category not found", "CategoryRead", err, name)
+			s.writeError(w, req, NewError(CodeNotFound, "Category not found"))
+			return
+		}
+		s.LogError("DB read category", "CategoryRead", err, name)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	r, err := json.Marshal(&CategoryFull{ServiceName: c.ServiceName, Category: c.Category})
+	if err != nil {
+		s.LogError("JSON marshal error", "CategoryRead", err, c)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// Category Set (PUT)
+func (s *Server) CategorySet(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		s.LogError("get request body", "CategorySet", err, nil)
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
+		return
+	}
+	defer req.Body.Close()
+
+	catreq := &CategoryFull{}
+	err = json.Unmarshal(body, catreq)
+	if err != nil {
+		s.LogError("get JSON body", "CategorySet", err, string(body))
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
+		return
+	}
+	if catreq.Category == "" {
+		s.LogError("category is required", "CategorySet", nil, catreq)
+		s.writeError(w, req, NewError(CodeValidationFailed, "category is required"))
+		return
+	}
+
+	err = s.repo.CategorySet(req.Context(), model.ServiceCategory{ServiceName: name, Category: catreq.Category})
+	if err != nil {
+		s.LogError("DB set category", "CategorySet", err, catreq)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Category Delete
+func (s *Server) CategoryDelete(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+
+	err := s.repo.CategoryDelete(req.Context(), name)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			s.LogError("Category not found", "CategoryDelete", err, name)
+			s.writeError(w, req, NewError(CodeNotFound, "Category not found"))
+			return
+		}
+		s.LogError("DB delete category", "CategoryDelete", err, name)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
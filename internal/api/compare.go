@@ -0,0 +1,147 @@
+package emsub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	utils "github.com/glkeru/EM_Subscriptions/internal/utils"
+)
+
+// Compare
+func (s *Server) SubscriptionCompare(w http.ResponseWriter, req *http.Request) {
+	vars := req.URL.Query()
+
+	f, err := parseFilter(vars)
+	if err != nil {
+		s.LogError("filter format is wrong", "SubscriptionCompare", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+	if f.Start == nil || f.End == nil || utils.MonthsBetween(*f.Start, *f.End) <= 0 {
+		s.LogError("period is wrong", "SubscriptionCompare", nil, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, "start_date and end_date are required, end_date must not be before start_date"))
+		return
+	}
+
+	// период сравнения, по умолчанию - предыдущий такой же длины
+	months := utils.MonthsBetween(*f.Start, *f.End)
+	prevStart := f.Start.AddDate(0, -months, 0)
+	prevEnd := f.Start.AddDate(0, -1, 0)
+	if str := vars.Get("previous_start_date"); str != "" {
+		prevStart, err = utils.ParseDate(str, DateFormat)
+		if err != nil {
+			s.LogError("previous_start_date format is wrong", "SubscriptionCompare", err, vars)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "previous_start_date format is wrong"))
+			return
+		}
+	}
+	if str := vars.Get("previous_end_date"); str != "" {
+		prevEnd, err = utils.ParseDate(str, DateFormat)
+		if err != nil {
+			s.LogError("previous_end_date format is wrong", "SubscriptionCompare", err, vars)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "previous_end_date format is wrong"))
+			return
+		}
+	}
+	if utils.MonthsBetween(prevStart, prevEnd) <= 0 {
+		s.LogError("previous period is wrong", "SubscriptionCompare", nil, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, "previous_end_date must not be before previous_start_date"))
+		return
+	}
+	pf := f
+	pf.Start, pf.End = &prevStart, &prevEnd
+
+	current, err := s.serviceTotals(req.Context(), f)
+	if err != nil {
+		s.LogError("DB total group error", "SubscriptionCompare", err, vars)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+	previous, err := s.serviceTotals(req.Context(), pf)
+	if err != nil {
+		s.LogError("DB total group error", "SubscriptionCompare", err, vars)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	resp := &CompareResponse{}
+	resp.Current = comparePeriod(*f.Start, *f.End)
+	resp.Previous = comparePeriod(prevStart, prevEnd)
+
+	// вклад сервисов в изменение, включая пропавшие и новые
+	names := make(map[string]bool)
+	for name, total := range current {
+		resp.Current.Total += total
+		names[name] = true
+	}
+	for name, total := range previous {
+		resp.Previous.Total += total
+		names[name] = true
+	}
+	resp.Delta, resp.DeltaPercent = compareDelta(resp.Current.Total, resp.Previous.Total)
+
+	resp.Services = make([]CompareService, 0, len(names))
+	for name := range names {
+		svc := CompareService{ServiceName: name, Current: current[name], Previous: previous[name]}
+		svc.Delta, svc.DeltaPercent = compareDelta(svc.Current, svc.Previous)
+		resp.Services = append(resp.Services, svc)
+	}
+	sort.Slice(resp.Services, func(i, j int) bool {
+		a, b := abs64(resp.Services[i].Delta), abs64(resp.Services[j].Delta)
+		if a != b {
+			return a > b
+		}
+		return resp.Services[i].ServiceName < resp.Services[j].ServiceName
+	})
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "SubscriptionCompare", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// суммы за период по сервисам, той же логикой, что и разбивка /total
+func (s *Server) serviceTotals(ctx context.Context, f model.Filter) (map[string]uint, error) {
+	groups, err := s.repo.SubscriptionTotalGroup(ctx, f, []string{model.GroupService})
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[string]uint, len(groups))
+	for _, g := range groups {
+		if g.ServiceName != nil {
+			totals[*g.ServiceName] += g.Total
+		}
+	}
+	return totals, nil
+}
+
+func comparePeriod(start, end time.Time) ComparePeriod {
+	return ComparePeriod{StartDate: start.Format(DateFormat), EndDate: end.Format(DateFormat)}
+}
+
+// изменение и процент изменения, процента нет при нулевой базе
+func compareDelta(current, previous uint) (int64, *float64) {
+	delta := int64(current) - int64(previous)
+	if previous == 0 {
+		return delta, nil
+	}
+	pct := float64(delta) * 100 / float64(previous)
+	return delta, &pct
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -1,8 +1,16 @@
 package emsub
 
-import "github.com/google/uuid"
+import (
+	"bytes"
+	"encoding/json"
+	"time"
 
-const DateFormat = "01-2006"
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	validate "github.com/glkeru/EM_Subscriptions/internal/validate"
+	"github.com/google/uuid"
+)
+
+const DateFormat = validate.DateFormat
 
 type SubscriptionFull struct {
 	Id          uuid.UUID `json:"id"`
@@ -14,7 +22,12 @@ type SubscriptionFull struct {
 }
 
 type SubscriptionCreateResponse struct {
-	Id uuid.UUID `json:"id"`
+	Id       uuid.UUID `json:"id"`
+	Warnings []string  `json:"warnings,omitempty"`
+}
+
+type SubscriptionWarningResponse struct {
+	Warnings []string `json:"warnings"`
 }
 
 type SubscriptionListResponse struct {
@@ -23,6 +36,492 @@ type SubscriptionListResponse struct {
 	Offset int                `json:"offset,omitempty"`
 }
 
+// список с выбранными полями (fields)
+type SubscriptionFieldsListResponse struct {
+	Limit  int                  `json:"limit,omitempty"`
+	Offset int                  `json:"offset,omitempty"`
+	Data   []SubscriptionFields `json:"data"`
+}
+
+// поля подписки в порядке запроса
+type SubscriptionFields struct {
+	Keys   []string
+	Values []any
+}
+
+func (sf SubscriptionFields) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range sf.Keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(sf.Values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
 type SubscriptionTotalResponse struct {
-	Price uint `json:"total"`
+	Price  uint                 `json:"total"`
+	Groups []TotalGroupResponse `json:"groups,omitempty"`
+	Lines  []TotalLineResponse  `json:"lines,omitempty"`
+}
+
+type TotalLineResponse struct {
+	Id          uuid.UUID `json:"id"`
+	ServiceName string    `json:"service_name"`
+	UserId      uuid.UUID `json:"user_id"`
+	Price       uint      `json:"price"`
+	StartDate   string    `json:"start_date"`
+	EndDate     string    `json:"end_date"`
+	Months      int       `json:"months"`
+	Subtotal    uint      `json:"subtotal"`
+}
+
+type TotalGroupResponse struct {
+	ServiceName *string    `json:"service_name,omitempty"`
+	UserId      *uuid.UUID `json:"user_id,omitempty"`
+	Month       string     `json:"month,omitempty"`
+	Total       uint       `json:"total"`
+	Count       int        `json:"count"`
+}
+
+type TimeSeriesResponse struct {
+	Points []TimeSeriesPoint `json:"points"`
+	Total  uint              `json:"total"`
+}
+
+type TimeSeriesPoint struct {
+	Month        string   `json:"month"`
+	Total        uint     `json:"total"`
+	Count        int      `json:"count"`
+	Cumulative   *uint    `json:"cumulative,omitempty"`
+	Previous     *uint    `json:"previous,omitempty"`
+	Delta        *int64   `json:"delta,omitempty"`
+	DeltaPercent *float64 `json:"delta_percent,omitempty"`
+}
+
+type ForecastResponse struct {
+	Points        []ForecastPoint `json:"points"`
+	Total         uint            `json:"total"`
+	ScenarioTotal uint            `json:"scenario_total,omitempty"`
+	ChurnRate     *float64        `json:"churn_rate,omitempty"`
+	Inflation     *float64        `json:"inflation,omitempty"`
+}
+
+type ForecastPoint struct {
+	Month    string `json:"month"`
+	Total    uint   `json:"total"`
+	Count    int    `json:"count"`
+	Scenario *uint  `json:"scenario,omitempty"`
+}
+
+type BudgetFull struct {
+	Id          uuid.UUID `json:"id"`
+	UserId      uuid.UUID `json:"user_id"`
+	Amount      uint      `json:"amount"`
+	ServiceName string    `json:"service_name,omitempty"`
+	Category    string    `json:"category,omitempty"`
+	Threshold   uint      `json:"threshold,omitempty"`
+}
+
+type BudgetCreateResponse struct {
+	Id uuid.UUID `json:"id"`
+}
+
+type BudgetListResponse struct {
+	Data []BudgetFull `json:"data"`
+}
+
+type BudgetStatusResponse struct {
+	Budget           BudgetFull            `json:"budget"`
+	Month            string                `json:"month"`
+	Current          uint                  `json:"current"`
+	Projected        uint                  `json:"projected"`
+	Threshold        uint                  `json:"threshold"`
+	CurrentPercent   float64               `json:"current_percent"`
+	ProjectedPercent float64               `json:"projected_percent"`
+	Alerts           []BudgetAlertResponse `json:"alerts"`
+}
+
+type BudgetAlertResponse struct {
+	Kind  string `json:"kind"`
+	Month string `json:"month"`
+	Spend uint   `json:"spend"`
+}
+
+type CategoryFull struct {
+	ServiceName string `json:"service_name"`
+	Category    string `json:"category"`
+}
+
+type CategoryListResponse struct {
+	Data []CategoryFull `json:"data"`
+}
+
+type ChurnResponse struct {
+	Services []ChurnService       `json:"services"`
+	Total    []ChurnPointResponse `json:"total"`
+}
+
+type ChurnService struct {
+	ServiceName string               `json:"service_name"`
+	Points      []ChurnPointResponse `json:"points"`
+}
+
+type ChurnPointResponse struct {
+	Month     string  `json:"month"`
+	New       int     `json:"new"`
+	Churned   int     `json:"churned"`
+	Active    int     `json:"active"`
+	ChurnRate float64 `json:"churn_rate"`
+}
+
+type RetentionResponse struct {
+	Periods int               `json:"periods"`
+	Cohorts []RetentionCohort `json:"cohorts"`
+}
+
+type RetentionCohort struct {
+	Cohort    string           `json:"cohort"`
+	Size      int              `json:"size"`
+	Retention []RetentionPoint `json:"retention"`
+}
+
+type RetentionPoint struct {
+	Period  int     `json:"period"`
+	Count   int     `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+type MRRResponse struct {
+	Points []MRRPointResponse `json:"points"`
+}
+
+type MRRPointResponse struct {
+	Month       string `json:"month"`
+	MRR         uint   `json:"mrr"`
+	New         uint   `json:"new"`
+	Expansion   uint   `json:"expansion"`
+	Contraction uint   `json:"contraction"`
+	Churned     uint   `json:"churned"`
+	NetChange   int64  `json:"net_change"`
+}
+
+type ServiceStatsResponse struct {
+	ServiceName string `json:"service_name"`
+	PriceStatsResponse
+	History []PriceStatsResponse `json:"history"`
+}
+
+type PriceStatsResponse struct {
+	Month       string  `json:"month,omitempty"`
+	Subscribers int     `json:"subscribers"`
+	Count       int     `json:"count"`
+	Min         uint    `json:"min"`
+	Max         uint    `json:"max"`
+	Mean        float64 `json:"mean"`
+	Median      float64 `json:"median"`
+	P90         float64 `json:"p90"`
+}
+
+type AnomalyListResponse struct {
+	Data []AnomalyResponse `json:"data"`
+}
+
+type AnomalyResponse struct {
+	SubscriptionFull
+	Median  float64 `json:"median"`
+	Low     float64 `json:"low"`
+	High    float64 `json:"high"`
+	Samples int     `json:"samples"`
+}
+
+type RecommendationsResponse struct {
+	UserId        uuid.UUID                `json:"user_id"`
+	YearlySavings uint                     `json:"yearly_savings"`
+	Data          []RecommendationResponse `json:"data"`
+}
+
+type RecommendationResponse struct {
+	Kind          string   `json:"kind"`
+	ServiceName   string   `json:"service_name"`
+	Category      string   `json:"category,omitempty"`
+	Price         uint     `json:"price"`
+	Median        float64  `json:"median,omitempty"`
+	Months        int      `json:"months,omitempty"`
+	Alternatives  []string `json:"alternatives,omitempty"`
+	YearlyCost    uint     `json:"yearly_cost"`
+	YearlySavings uint     `json:"yearly_savings"`
+}
+
+type UserReportResponse struct {
+	UserId        uuid.UUID          `json:"user_id"`
+	Year          int                `json:"year"`
+	Total         uint               `json:"total"`
+	Services      []ReportService    `json:"services"`
+	Months        []TimeSeriesPoint  `json:"months"`
+	MostExpensive *SubscriptionFull  `json:"most_expensive,omitempty"`
+	Started       []SubscriptionFull `json:"started"`
+	Ended         []SubscriptionFull `json:"ended"`
+}
+
+type ReportService struct {
+	ServiceName string `json:"service_name"`
+	Total       uint   `json:"total"`
+	Count       int    `json:"count"`
+}
+
+type CompareResponse struct {
+	Current      ComparePeriod    `json:"current"`
+	Previous     ComparePeriod    `json:"previous"`
+	Delta        int64            `json:"delta"`
+	DeltaPercent *float64         `json:"delta_percent,omitempty"`
+	Services     []CompareService `json:"services"`
+}
+
+type ComparePeriod struct {
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Total     uint   `json:"total"`
+}
+
+type CompareService struct {
+	ServiceName  string   `json:"service_name"`
+	Current      uint     `json:"current"`
+	Previous     uint     `json:"previous"`
+	Delta        int64    `json:"delta"`
+	DeltaPercent *float64 `json:"delta_percent,omitempty"`
+}
+
+type ImportResponse struct {
+	DryRun  bool        `json:"dry_run"`
+	Created int         `json:"created"`
+	Skipped int         `json:"skipped"`
+	Failed  int         `json:"failed"`
+	Rows    []ImportRow `json:"rows"`
+}
+
+type ImportRow struct {
+	Row    int        `json:"row"`
+	Status string     `json:"status"`
+	Id     *uuid.UUID `json:"id,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+}
+
+type CalendarTokenResponse struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// событие потока /api/v1/events
+type SubscriptionEventResponse struct {
+	Type         string           `json:"type"`
+	Time         time.Time        `json:"time"`
+	Subscription SubscriptionFull `json:"subscription"`
+}
+
+// подписка в формате ответа
+func subscriptionFull(sub model.Subscription) SubscriptionFull {
+	var full SubscriptionFull
+	full.Id = sub.Id
+	full.ServiceName = sub.ServiceName
+	full.UserId = sub.UserId
+	full.Price = sub.Price
+	full.StartDate = sub.StartDate.Format(DateFormat)
+	if sub.EndDate != nil {
+		full.EndDate = sub.EndDate.Format(DateFormat)
+	}
+	return full
+}
+
+// строка разбивки суммы в формате ответа
+func totalGroupResponse(g model.TotalGroup) TotalGroupResponse {
+	var resp TotalGroupResponse
+	resp.ServiceName = g.ServiceName
+	resp.UserId = g.UserId
+	if g.Month != nil {
+		resp.Month = g.Month.Format(DateFormat)
+	}
+	resp.Total = g.Total
+	resp.Count = g.Count
+	return resp
+}
+
+// бюджет в формате ответа
+func budgetFull(b model.Budget) BudgetFull {
+	var full BudgetFull
+	full.Id = b.Id
+	full.UserId = b.UserId
+	full.Amount = b.Amount
+	if b.ServiceName != nil {
+		full.ServiceName = *b.ServiceName
+	}
+	if b.Category != nil {
+		full.Category = *b.Category
+	}
+	if b.Threshold != nil {
+		full.Threshold = *b.Threshold
+	}
+	return full
+}
+
+// состояние бюджета в формате ответа
+func budgetStatusResponse(st model.BudgetStatus) BudgetStatusResponse {
+	var resp BudgetStatusResponse
+	resp.Budget = budgetFull(st.Budget)
+	resp.Month = st.Month.Format(DateFormat)
+	resp.Current = st.Current
+	resp.Projected = st.Projected
+	resp.Threshold = st.Threshold
+	resp.CurrentPercent = float64(st.Current) * 100 / float64(st.Budget.Amount)
+	resp.ProjectedPercent = float64(st.Projected) * 100 / float64(st.Budget.Amount)
+	resp.Alerts = make([]BudgetAlertResponse, 0, len(st.Alerts))
+	for _, a := range st.Alerts {
+		resp.Alerts = append(resp.Alerts, BudgetAlertResponse{Kind: a.Kind, Month: a.Month.Format(DateFormat), Spend: a.Spend})
+	}
+	return resp
+}
+
+// отток за месяц в формате ответа
+// churn_rate - доля ушедших от активных за месяц, %
+func churnPointResponse(p model.ChurnPoint) ChurnPointResponse {
+	var resp ChurnPointResponse
+	resp.Month = p.Month.Format(DateFormat)
+	resp.New = p.New
+	resp.Churned = p.Churned
+	resp.Active = p.Active
+	if p.Active > 0 {
+		resp.ChurnRate = float64(p.Churned) * 100 / float64(p.Active)
+	}
+	return resp
+}
+
+// когорта в формате ответа
+func retentionCohort(c model.Cohort) RetentionCohort {
+	var resp RetentionCohort
+	resp.Cohort = c.Month.Format(DateFormat)
+	resp.Size = c.Size
+	resp.Retention = make([]RetentionPoint, 0, len(c.Retained))
+	for i, count := range c.Retained {
+		p := RetentionPoint{Period: i + 1, Count: count}
+		if c.Size > 0 {
+			p.Percent = float64(count) * 100 / float64(c.Size)
+		}
+		resp.Retention = append(resp.Retention, p)
+	}
+	return resp
+}
+
+// статистика цен в формате ответа
+func priceStatsResponse(st model.PriceStats) PriceStatsResponse {
+	var resp PriceStatsResponse
+	if st.Month != nil {
+		resp.Month = st.Month.Format(DateFormat)
+	}
+	resp.Subscribers = st.Subscribers
+	resp.Count = st.Count
+	resp.Min = st.Min
+	resp.Max = st.Max
+	resp.Mean = st.Mean
+	resp.Median = st.Median
+	resp.P90 = st.P90
+	return resp
+}
+
+// аномалия цены в формате ответа
+func anomalyResponse(a model.PriceAnomaly) AnomalyResponse {
+	var resp AnomalyResponse
+	resp.SubscriptionFull = subscriptionFull(a.Subscription)
+	resp.Median = a.Bounds.Median
+	resp.Low = max(a.Bounds.Low, 0)
+	resp.High = a.Bounds.High
+	resp.Samples = a.Bounds.Count
+	return resp
+}
+
+// рекомендация в формате ответа
+func recommendationResponse(rec model.Recommendation) RecommendationResponse {
+	var resp RecommendationResponse
+	resp.Kind = rec.Kind
+	resp.ServiceName = rec.ServiceName
+	resp.Category = rec.Category
+	resp.Price = rec.Price
+	resp.Median = rec.Median
+	resp.Months = rec.Months
+	resp.Alternatives = rec.Alternatives
+	resp.YearlyCost = rec.YearlyCost
+	resp.YearlySavings = rec.YearlySavings
+	return resp
+}
+
+// годовой отчет в формате ответа
+func userReportResponse(rep model.UserReport) UserReportResponse {
+	var resp UserReportResponse
+	resp.UserId = rep.UserId
+	resp.Year = rep.Year
+	resp.Total = rep.Total
+	resp.Services = make([]ReportService, 0, len(rep.Services))
+	for _, g := range rep.Services {
+		var svc ReportService
+		if g.ServiceName != nil {
+			svc.ServiceName = *g.ServiceName
+		}
+		svc.Total = g.Total
+		svc.Count = g.Count
+		resp.Services = append(resp.Services, svc)
+	}
+	resp.Months = make([]TimeSeriesPoint, 0, len(rep.Months))
+	for _, m := range rep.Months {
+		resp.Months = append(resp.Months, TimeSeriesPoint{Month: m.Month.Format(DateFormat), Total: m.Total, Count: m.Count})
+	}
+	if rep.MostExpensive != nil {
+		full := subscriptionFull(*rep.MostExpensive)
+		resp.MostExpensive = &full
+	}
+	resp.Started = make([]SubscriptionFull, 0, len(rep.Started))
+	for _, sub := range rep.Started {
+		resp.Started = append(resp.Started, subscriptionFull(sub))
+	}
+	resp.Ended = make([]SubscriptionFull, 0, len(rep.Ended))
+	for _, sub := range rep.Ended {
+		resp.Ended = append(resp.Ended, subscriptionFull(sub))
+	}
+	return resp
+}
+
+// строка расшифровки суммы в формате ответа
+func totalLineResponse(l model.TotalLine) TotalLineResponse {
+	var resp TotalLineResponse
+	resp.Id = l.Id
+	resp.ServiceName = l.ServiceName
+	resp.UserId = l.UserId
+	resp.Price = l.Price
+	resp.StartDate = l.OverlapStart.Format(DateFormat)
+	resp.EndDate = l.OverlapEnd.Format(DateFormat)
+	resp.Months = l.Months
+	resp.Subtotal = l.Subtotal
+	return resp
+}
+
+// ошибка в формате RFC 7807 (application/problem+json)
+type ProblemResponse struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestId string `json:"request_id,omitempty"`
 }
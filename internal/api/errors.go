@@ -0,0 +1,105 @@
+package emsub
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const ContentTypeProblem = "application/problem+json" // RFC 7807
+
+// коды ошибок API: стабильны, клиенты разбирают ответ по ним, а не по тексту
+const (
+	CodeInvalidId            = "invalid_id"
+	CodeInvalidParameter     = "invalid_parameter"
+	CodeInvalidBody          = "invalid_body"
+	CodeValidationFailed     = "validation_failed"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeUnprocessable        = "unprocessable_entity"
+	CodeIdempotencyReused    = "idempotency_key_reused"
+	CodeIdempotencyInUse     = "idempotency_key_in_progress"
+	CodeInternal             = "internal_error"
+)
+
+var codeStatus = map[string]int{
+	CodeInvalidId:            http.StatusBadRequest,
+	CodeInvalidParameter:     http.StatusBadRequest,
+	CodeInvalidBody:          http.StatusBadRequest,
+	CodeValidationFailed:     http.StatusBadRequest,
+	CodeNotFound:             http.StatusNotFound,
+	CodeMethodNotAllowed:     http.StatusMethodNotAllowed,
+	CodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	CodeUnprocessable:        http.StatusUnprocessableEntity,
+	CodeIdempotencyReused:    http.StatusUnprocessableEntity,
+	CodeIdempotencyInUse:     http.StatusConflict,
+	CodeInternal:             http.StatusInternalServerError,
+}
+
+// ошибка API: код и текст для клиента. Внутренние причины пишутся в лог через LogError
+// и в ответ не попадают
+type Error struct {
+	Code   string
+	Detail string
+}
+
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func (e *Error) Status() int {
+	if status, ok := codeStatus[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+func NewError(code, detail string) *Error {
+	return &Error{Code: code, Detail: detail}
+}
+
+// ошибки без подробностей для клиента
+var (
+	ErrInvalidId = NewError(CodeInvalidId, "id must be a UUID")
+	ErrInternal  = NewError(CodeInternal, "")
+)
+
+// ответ с ошибкой: для 5xx текст всегда общий
+func (s *Server) writeError(w http.ResponseWriter, req *http.Request, e *Error) {
+	status := e.Status()
+	problem := &ProblemResponse{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    e.Detail,
+		Instance:  req.URL.Path,
+		Code:      e.Code,
+		RequestId: RequestId(req.Context()),
+	}
+	if status >= http.StatusInternalServerError {
+		problem.Detail = ""
+	}
+
+	r, err := json.Marshal(problem)
+	if err != nil {
+		s.LogError("JSON marshal error", "writeError", err, problem)
+		r = []byte(`{"type":"about:blank","status":500,"code":"internal_error"}`)
+	}
+	w.Header().Del("Content-Disposition")
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(r)
+}
+
+// маршрут не найден или метод не поддерживается
+func (s *Server) NotFound(w http.ResponseWriter, req *http.Request) {
+	s.writeError(w, req, NewError(CodeNotFound, "resource not found"))
+}
+
+func (s *Server) MethodNotAllowed(w http.ResponseWriter, req *http.Request) {
+	s.writeError(w, req, NewError(CodeMethodNotAllowed, req.Method+" is not allowed"))
+}
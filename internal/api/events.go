@@ -0,0 +1,121 @@
+package emsub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/google/uuid"
+)
+
+// дедлайн записи одного события: WriteTimeout сервера для потока снимается
+const EventWriteTimeout = 10 * time.Second
+
+// пауза перед переподключением клиента, мс
+const EventRetry = 3000
+
+// Events (Server-Sent Events)
+func (s *Server) SubscriptionEvents(w http.ResponseWriter, req *http.Request) {
+	vars := req.URL.Query()
+
+	var user uuid.UUID
+	var err error
+	if strid := vars.Get("user_id"); strid != "" {
+		user, err = uuid.Parse(strid)
+		if err != nil {
+			s.LogError("user_id format is wrong", "SubscriptionEvents", err, nil)
+			s.writeError(w, req, NewError(CodeInvalidId, "user_id format is wrong"))
+			return
+		}
+	}
+	service := vars.Get("service_name")
+
+	// Last-Event-ID от EventSource или параметр для первого подключения
+	lastid := req.Header.Get("Last-Event-ID")
+	if lastid == "" {
+		lastid = vars.Get("last_event_id")
+	}
+	var last uint64
+	if lastid != "" {
+		last, err = strconv.ParseUint(lastid, 10, 64)
+		if err != nil {
+			s.LogError("Last-Event-ID format is wrong", "SubscriptionEvents", err, lastid)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "Last-Event-ID format is wrong"))
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	// поток бессрочный: общий WriteTimeout сервера заменяем дедлайном на каждую запись
+	err = rc.SetWriteDeadline(time.Now().Add(EventWriteTimeout))
+	if err != nil {
+		s.LogError("streaming is not supported", "SubscriptionEvents", err, nil)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	replay, complete, events, cancel := s.events.Subscribe(last)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(chunk string) bool {
+		rc.SetWriteDeadline(time.Now().Add(EventWriteTimeout))
+		_, err := fmt.Fprint(w, chunk)
+		if err == nil {
+			err = rc.Flush()
+		}
+		return err == nil
+	}
+	send := func(e model.SubscriptionEvent) bool {
+		if user != uuid.Nil && e.Subscription.UserId != user {
+			return true
+		}
+		if service != "" && e.Subscription.ServiceName != service {
+			return true
+		}
+		data, err := json.Marshal(SubscriptionEventResponse{e.Type, e.Time, subscriptionFull(e.Subscription)})
+		if err != nil {
+			s.LogError("JSON marshal error", "SubscriptionEvents", err, e)
+			return false
+		}
+		return write(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", e.Id, e.Type, data))
+	}
+
+	if !write(fmt.Sprintf("retry: %d\n\n", EventRetry)) {
+		return
+	}
+	// часть событий вытеснена из буфера: клиенту нужно перечитать данные
+	if !complete && !write("event: reset\ndata: {}\n\n") {
+		return
+	}
+	for _, e := range replay {
+		if !send(e) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(time.Duration(max(s.config.EventsHeartbeat, 1)) * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			if !write(": heartbeat\n\n") {
+				return
+			}
+		case e, ok := <-events:
+			// отстали или сервер останавливается - клиент переподключится с Last-Event-ID
+			if !ok || !send(e) {
+				return
+			}
+		}
+	}
+}
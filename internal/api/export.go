@@ -0,0 +1,415 @@
+package emsub
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+
+	ContentTypeCSV  = "text/csv"
+	ContentTypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// сколько может идти выгрузка через курсор, WriteTimeout сервера для нее продлевается
+const ExportTimeout = 10 * time.Minute
+
+// сбрасывать CSV в ответ каждые N строк
+const csvFlushRows = 1000
+
+// трейлер CSV: complete - файл полный, error - выгрузка оборвалась
+const (
+	ExportStatusTrailer = "X-Export-Status"
+	ExportStatusOK      = "complete"
+	ExportStatusError   = "error"
+)
+
+// последняя строка CSV при обрыве выгрузки - для клиентов без поддержки трейлеров
+const csvErrorMarker = "# export failed, file is incomplete"
+
+var subscriptionHeader = []string{"id", "service_name", "user_id", "price", "start_date", "end_date"}
+
+// формат ответа: параметр format, затем Accept, по умолчанию JSON
+func exportFormat(req *http.Request) (string, error) {
+	switch f := req.URL.Query().Get("format"); f {
+	case FormatJSON, FormatCSV, FormatXLSX:
+		return f, nil
+	case "":
+	default:
+		return "", errors.New("format must be json, csv or xlsx")
+	}
+	for _, part := range strings.Split(req.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mt {
+		case ContentTypeCSV:
+			return FormatCSV, nil
+		case ContentTypeXLSX:
+			return FormatXLSX, nil
+		case "application/json":
+			return FormatJSON, nil
+		}
+	}
+	return FormatJSON, nil
+}
+
+// табличная выгрузка: CSV пишется в ответ сразу, XLSX отдается целиком при Close
+type tableWriter interface {
+	Write(row []any) error
+	// лист со сводкой, в CSV не выводится
+	Summary(header []string, rows [][]any) error
+	Close() error
+	// освободить ресурсы без отправки, после ошибки
+	Abort()
+}
+
+func newTable(w http.ResponseWriter, format, name string, header []string) (tableWriter, error) {
+	if format == FormatXLSX {
+		return newXLSXTable(w, name, header)
+	}
+	w.Header().Set("Content-Type", ContentTypeCSV+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+	w.Header().Set("Trailer", ExportStatusTrailer)
+	w.WriteHeader(http.StatusOK)
+	t := &csvTable{w: csv.NewWriter(w), out: w}
+	return t, t.w.Write(header)
+}
+
+type csvTable struct {
+	w   *csv.Writer
+	out http.ResponseWriter
+	n   int
+}
+
+func (t *csvTable) Write(row []any) error {
+	record := make([]string, len(row))
+	for i, v := range row {
+		if s, ok := v.(string); ok {
+			record[i] = csvEscape(s)
+		} else if v != nil {
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	err := t.w.Write(record)
+	if err != nil {
+		return err
+	}
+	t.n++
+	if t.n%csvFlushRows == 0 {
+		t.w.Flush()
+		_ = http.NewResponseController(t.out).Flush()
+	}
+	return t.w.Error()
+}
+
+// строка, начинающаяся с =, +, - или @, открывается в Excel как формула: экранируем апострофом
+func csvEscape(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func (t *csvTable) Summary(header []string, rows [][]any) error {
+	return nil
+}
+
+func (t *csvTable) Close() error {
+	t.w.Flush()
+	err := t.w.Error()
+	if err == nil {
+		t.out.Header().Set(ExportStatusTrailer, ExportStatusOK)
+	}
+	return err
+}
+
+// статус уже отправлен: отмечаем обрыв строкой в конце файла и трейлером
+func (t *csvTable) Abort() {
+	t.w.Flush()
+	fmt.Fprintln(t.out, csvErrorMarker)
+	t.out.Header().Set(ExportStatusTrailer, ExportStatusError)
+}
+
+type xlsxTable struct {
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	out    http.ResponseWriter
+	name   string
+	row    int
+}
+
+func newXLSXTable(w http.ResponseWriter, name string, header []string) (*xlsxTable, error) {
+	file := excelize.NewFile()
+	err := file.SetSheetName("Sheet1", name)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := file.NewStreamWriter(name)
+	if err != nil {
+		return nil, err
+	}
+	err = stream.SetColWidth(1, len(header), 20)
+	if err != nil {
+		return nil, err
+	}
+	t := &xlsxTable{file: file, stream: stream, out: w, name: name}
+	cells := make([]any, len(header))
+	for i, h := range header {
+		cells[i] = h
+	}
+	return t, t.Write(cells)
+}
+
+func (t *xlsxTable) Write(row []any) error {
+	t.row++
+	cell, err := excelize.CoordinatesToCellName(1, t.row)
+	if err != nil {
+		return err
+	}
+	return t.stream.SetRow(cell, row)
+}
+
+func (t *xlsxTable) Summary(header []string, rows [][]any) error {
+	const sheet = "Summary"
+	_, err := t.file.NewSheet(sheet)
+	if err != nil {
+		return err
+	}
+	err = t.file.SetColWidth(sheet, "A", "C", 20)
+	if err != nil {
+		return err
+	}
+	cells := make([]any, len(header))
+	for i, h := range header {
+		cells[i] = h
+	}
+	err = t.file.SetSheetRow(sheet, "A1", &cells)
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		err = t.file.SetSheetRow(sheet, cell, &row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *xlsxTable) Abort() {
+	t.file.Close()
+}
+
+func (t *xlsxTable) Close() error {
+	defer t.file.Close()
+	err := t.stream.Flush()
+	if err != nil {
+		return err
+	}
+	t.out.Header().Set("Content-Type", ContentTypeXLSX)
+	t.out.Header().Set("Content-Disposition", `attachment; filename="`+t.name+`.xlsx"`)
+	t.out.WriteHeader(http.StatusOK)
+	_, err = t.file.WriteTo(t.out)
+	return err
+}
+
+// сводка по сервисам за период - по логике SubscriptionTotal
+func (s *Server) exportSummary(ctx context.Context, t tableWriter, f model.Filter) error {
+	if _, ok := t.(*xlsxTable); !ok {
+		return nil
+	}
+	groups, err := s.repo.SubscriptionTotalGroup(ctx, f, []string{model.GroupService})
+	if err != nil {
+		return err
+	}
+	rows := make([][]any, 0, len(groups)+1)
+	var count int
+	var total uint
+	for _, g := range groups {
+		rows = append(rows, []any{*g.ServiceName, g.Count, g.Total})
+		count += g.Count
+		total += g.Total
+	}
+	rows = append(rows, []any{"total", count, total})
+	return t.Summary([]string{"service_name", "count", "total"}, rows)
+}
+
+func subscriptionRow(sub model.Subscription) []any {
+	var end any
+	if sub.EndDate != nil {
+		end = sub.EndDate.Format(DateFormat)
+	}
+	return []any{sub.Id.String(), sub.ServiceName, sub.UserId.String(), sub.Price, sub.StartDate.Format(DateFormat), end}
+}
+
+// значения выбранных колонок строки
+func subscriptionColumns(sub model.Subscription, fields []string) []any {
+	row := subscriptionRow(sub)
+	values := make([]any, 0, len(fields))
+	for _, f := range fields {
+		values = append(values, row[slices.Index(subscriptionHeader, f)])
+	}
+	return values
+}
+
+// табличный ответ может писаться дольше WriteTimeout сервера
+func (s *Server) extendWriteDeadline(w http.ResponseWriter, handler string) {
+	err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(ExportTimeout))
+	if err != nil {
+		s.LogError("set write deadline", handler, err, nil)
+	}
+}
+
+// Export
+func (s *Server) SubscriptionExport(w http.ResponseWriter, req *http.Request) {
+	vars := req.URL.Query()
+
+	format, err := exportFormat(req)
+	if err != nil {
+		s.LogError("format is wrong", "SubscriptionExport", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+	if format == FormatJSON {
+		format = FormatCSV
+	}
+	f, err := parseFilter(vars)
+	if err != nil {
+		s.LogError("filter format is wrong", "SubscriptionExport", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+	f.Expr, err = parseFilterExpr(vars)
+	if err != nil {
+		s.LogError("filter is wrong", "SubscriptionExport", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+
+	s.extendWriteDeadline(w, "SubscriptionExport")
+
+	t, err := newTable(w, format, "subscriptions", subscriptionHeader)
+	if err != nil {
+		s.LogError("export init error", "SubscriptionExport", err, vars)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+	err = s.repo.SubscriptionExport(req.Context(), f, func(sub model.Subscription) error {
+		return t.Write(subscriptionRow(sub))
+	})
+	if err == nil {
+		err = s.exportSummary(req.Context(), t, f)
+	}
+	if err != nil {
+		// CSV уже частично отправлен, статус не поменять - Abort помечает файл неполным
+		t.Abort()
+		s.LogError("DB export error", "SubscriptionExport", err, vars)
+		if format == FormatXLSX {
+			s.writeError(w, req, ErrInternal)
+		}
+		return
+	}
+	err = t.Close()
+	if err != nil {
+		s.LogError("export write error", "SubscriptionExport", err, vars)
+	}
+}
+
+// список подписок в CSV/XLSX, в пределах limit
+func (s *Server) writeSubscriptionsTable(w http.ResponseWriter, req *http.Request, format string, subs []model.Subscription, f model.Filter, fields []string) {
+	header := subscriptionHeader
+	if len(fields) > 0 {
+		header = fields
+	}
+	s.extendWriteDeadline(w, "SubscriptionList")
+	t, err := newTable(w, format, "subscriptions", header)
+	for i := 0; err == nil && i < len(subs); i++ {
+		err = t.Write(subscriptionColumns(subs[i], header))
+	}
+	if err == nil {
+		err = s.exportSummary(req.Context(), t, f)
+	}
+	if err == nil {
+		err = t.Close()
+	}
+	if err != nil {
+		if t != nil {
+			t.Abort()
+		}
+		s.LogError("export error", "SubscriptionList", err, nil)
+		if format == FormatXLSX {
+			s.writeError(w, req, ErrInternal)
+		}
+	}
+}
+
+// сумма в CSV/XLSX: строки расшифровки, группы или одна строка итога
+func (s *Server) writeTotalTable(w http.ResponseWriter, req *http.Request, format string, resp *SubscriptionTotalResponse, f model.Filter) {
+	var header []string
+	var rows [][]any
+	switch {
+	case resp.Lines != nil:
+		header = []string{"id", "service_name", "user_id", "price", "start_date", "end_date", "months", "subtotal"}
+		for _, l := range resp.Lines {
+			rows = append(rows, []any{l.Id.String(), l.ServiceName, l.UserId.String(), l.Price, l.StartDate, l.EndDate, l.Months, l.Subtotal})
+		}
+	case resp.Groups != nil:
+		header = []string{"service_name", "user_id", "month", "total", "count"}
+		for _, g := range resp.Groups {
+			var service, user, month any
+			if g.ServiceName != nil {
+				service = *g.ServiceName
+			}
+			if g.UserId != nil {
+				user = g.UserId.String()
+			}
+			if g.Month != "" {
+				month = g.Month
+			}
+			rows = append(rows, []any{service, user, month, g.Total, g.Count})
+		}
+	default:
+		header = []string{"total"}
+		rows = [][]any{{resp.Price}}
+	}
+
+	s.extendWriteDeadline(w, "SubscriptionTotal")
+	t, err := newTable(w, format, "total", header)
+	for i := 0; err == nil && i < len(rows); i++ {
+		err = t.Write(rows[i])
+	}
+	if err == nil {
+		err = s.exportSummary(req.Context(), t, f)
+	}
+	if err == nil {
+		err = t.Close()
+	}
+	if err != nil {
+		if t != nil {
+			t.Abort()
+		}
+		s.LogError("export error", "SubscriptionTotal", err, nil)
+		if format == FormatXLSX {
+			s.writeError(w, req, ErrInternal)
+		}
+	}
+}
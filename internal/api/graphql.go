@@ -0,0 +1,180 @@
+package emsub
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/vektah/gqlparser/v2"
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+	"go.uber.org/zap"
+)
+
+// оценка длины списков без limit: суммы по сервисам и группам
+const GraphQLListCost = 10
+
+// страница списка подписок без limit
+const GraphQLPageSize = 100
+
+//go:embed graphql/schema.graphql
+var graphqlSchema string
+
+// схема для выполнения и она же для оценки сложности запроса
+type graphqlExecutor struct {
+	schema *graphql.Schema
+	ast    *gqlast.Schema
+}
+
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+func newGraphQL(s *Server) (*graphqlExecutor, error) {
+	schema, err := graphql.ParseSchema(graphqlSchema, &graphqlResolver{s},
+		graphql.MaxDepth(s.config.GraphQLDepth),
+		graphql.Logger(graphqlLogger{s.logger}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	sdl, err := gqlparser.LoadSchema(&gqlast.Source{Name: "schema.graphql", Input: graphqlSchema})
+	if err != nil {
+		return nil, err
+	}
+	return &graphqlExecutor{schema, sdl}, nil
+}
+
+// GraphQL
+func (s *Server) GraphQL(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		s.LogError("get request body", "GraphQL", err, nil)
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
+		return
+	}
+	defer req.Body.Close()
+
+	gqlreq := &graphqlRequest{}
+	err = json.Unmarshal(body, gqlreq)
+	if err != nil || gqlreq.Query == "" {
+		s.LogError("get JSON body", "GraphQL", err, string(body))
+		s.writeError(w, req, NewError(CodeInvalidBody, "query is required"))
+		return
+	}
+
+	var resp *graphql.Response
+	cost, err := s.graphql.complexity(gqlreq)
+	if err == nil && s.config.GraphQLComplexity > 0 && cost > s.config.GraphQLComplexity {
+		err = fmt.Errorf("query complexity %d exceeds limit %d", cost, s.config.GraphQLComplexity)
+	}
+	if err != nil {
+		s.LogError("query is too complex", "GraphQL", err, gqlreq.Query)
+		resp = &graphql.Response{Errors: []*gqlerrors.QueryError{gqlerrors.Errorf("%s", err)}}
+	} else {
+		// загрузчики живут в пределах одного запроса
+		ctx := withLoaders(req.Context(), s)
+		resp = s.graphql.schema.Exec(ctx, gqlreq.Query, gqlreq.OperationName, gqlreq.Variables)
+	}
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "GraphQL", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// сложность запроса: каждое поле стоит 1, поля-списки умножают стоимость вложенных полей
+// на limit (GraphQLPageSize, если не задан) и months (по умолчанию из схемы), остальные - на GraphQLListCost.
+// Невалидный запрос не оцениваем - ошибки вернет выполнение.
+func (g *graphqlExecutor) complexity(gqlreq *graphqlRequest) (int, error) {
+	doc, errs := gqlparser.LoadQuery(g.ast, gqlreq.Query)
+	if len(errs) > 0 {
+		return 0, nil
+	}
+	op := doc.Operations.ForName(gqlreq.OperationName)
+	if op == nil {
+		return 0, nil
+	}
+	return selectionCost(op.SelectionSet, gqlreq.Variables), nil
+}
+
+func selectionCost(set gqlast.SelectionSet, vars map[string]any) int {
+	cost := 0
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *gqlast.Field:
+			// интроспекция ограничена глубиной
+			if strings.HasPrefix(sel.Name, "__") {
+				continue
+			}
+			inner := selectionCost(sel.SelectionSet, vars)
+			if sel.Definition != nil && sel.Definition.Type.Elem != nil {
+				inner *= listSize(sel, vars)
+			}
+			cost += 1 + inner
+		case *gqlast.InlineFragment:
+			cost += selectionCost(sel.SelectionSet, vars)
+		case *gqlast.FragmentSpread:
+			if sel.Definition != nil {
+				cost += selectionCost(sel.Definition.SelectionSet, vars)
+			}
+		}
+	}
+	return cost
+}
+
+// ожидаемая длина списка по аргументам поля
+func listSize(f *gqlast.Field, vars map[string]any) int {
+	size := GraphQLListCost
+	for _, name := range []string{"limit", "months"} {
+		if name == "limit" && f.Definition.Arguments.ForName(name) != nil {
+			size = GraphQLPageSize
+		}
+		arg := f.Arguments.ForName(name)
+		if arg == nil {
+			if def := f.Definition.Arguments.ForName(name); def != nil && def.DefaultValue != nil {
+				arg = &gqlast.Argument{Value: def.DefaultValue}
+			}
+		}
+		if arg == nil {
+			continue
+		}
+		v, err := arg.Value.Value(vars)
+		if err != nil {
+			continue
+		}
+		switch n := v.(type) {
+		case int64:
+			if n > 0 {
+				return int(n)
+			}
+		case float64:
+			if n > 0 {
+				return int(n)
+			}
+		}
+	}
+	return size
+}
+
+// паники резолверов - в лог сервиса
+type graphqlLogger struct {
+	logger *zap.Logger
+}
+
+func (l graphqlLogger) LogPanic(ctx context.Context, value any) {
+	l.logger.Error("graphql resolver panic", zap.Any("panic", value))
+}
@@ -0,0 +1,163 @@
+package emsub
+
+import (
+	"context"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/google/uuid"
+	"github.com/graph-gophers/dataloader/v7"
+)
+
+// загрузчики GraphQL: поля списка подписок и пользователей собираются в один запрос к репозиторию
+type graphqlLoaders struct {
+	categories    *dataloader.Loader[string, *string]
+	services      *dataloader.Loader[userTotalKey, []model.TotalGroup]
+	subscriptions *dataloader.Loader[userListKey, []model.Subscription]
+}
+
+// суммы пользователя по сервисам за период
+type userTotalKey struct {
+	user        uuid.UUID
+	serviceName string
+	startDate   string
+	endDate     string
+}
+
+// страница подписок пользователя
+type userListKey struct {
+	user        uuid.UUID
+	serviceName string
+	startDate   string
+	endDate     string
+	limit       int
+	offset      int
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, s *Server) context.Context {
+	loaders := &graphqlLoaders{
+		categories:    dataloader.NewBatchedLoader(s.loadCategories),
+		services:      dataloader.NewBatchedLoader(s.loadUserServices),
+		subscriptions: dataloader.NewBatchedLoader(s.loadUserSubscriptions),
+	}
+	return context.WithValue(ctx, loadersKey{}, loaders)
+}
+
+func loadersFrom(ctx context.Context) *graphqlLoaders {
+	return ctx.Value(loadersKey{}).(*graphqlLoaders)
+}
+
+// категории всех запрошенных сервисов одним запросом
+func (s *Server) loadCategories(ctx context.Context, names []string) []*dataloader.Result[*string] {
+	results := make([]*dataloader.Result[*string], len(names))
+	cats, err := s.repo.CategoryReadMany(ctx, names)
+	if err != nil {
+		s.LogError("DB category error", "GraphQL", err, names)
+		for i := range results {
+			results[i] = &dataloader.Result[*string]{Error: errGraphQLInternal}
+		}
+		return results
+	}
+
+	byName := make(map[string]string, len(cats))
+	for _, c := range cats {
+		byName[c.ServiceName] = c.Category
+	}
+	for i, name := range names {
+		results[i] = &dataloader.Result[*string]{}
+		if cat, ok := byName[name]; ok {
+			results[i].Data = &cat
+		}
+	}
+	return results
+}
+
+// суммы по сервисам: один запрос с разбивкой по пользователям пакета на каждый период
+func (s *Server) loadUserServices(ctx context.Context, keys []userTotalKey) []*dataloader.Result[[]model.TotalGroup] {
+	results := make([]*dataloader.Result[[]model.TotalGroup], len(keys))
+
+	periods := make(map[userTotalKey][]int)
+	for i, k := range keys {
+		period := k
+		period.user = uuid.Nil
+		periods[period] = append(periods[period], i)
+	}
+
+	for period, idx := range periods {
+		vars := filterValues(nil, &period.serviceName, &period.startDate, &period.endDate)
+		f, err := parseFilter(vars)
+		if err == nil {
+			f.UserIds = make([]uuid.UUID, 0, len(idx))
+			for _, i := range idx {
+				f.UserIds = append(f.UserIds, keys[i].user)
+			}
+			var groups []model.TotalGroup
+			groups, err = s.repo.SubscriptionTotalGroup(ctx, f, []string{model.GroupUser, model.GroupService})
+			if err == nil {
+				byUser := make(map[uuid.UUID][]model.TotalGroup)
+				for _, g := range groups {
+					byUser[*g.UserId] = append(byUser[*g.UserId], g)
+				}
+				for _, i := range idx {
+					found := byUser[keys[i].user]
+					if found == nil {
+						found = []model.TotalGroup{}
+					}
+					results[i] = &dataloader.Result[[]model.TotalGroup]{Data: found}
+				}
+				continue
+			}
+			s.LogError("DB total group error", "GraphQL", err, vars)
+		}
+		for _, i := range idx {
+			results[i] = &dataloader.Result[[]model.TotalGroup]{Error: err}
+		}
+	}
+	return results
+}
+
+// подписки пользователей: один запрос по пользователям пакета на каждый фильтр и страницу
+func (s *Server) loadUserSubscriptions(ctx context.Context, keys []userListKey) []*dataloader.Result[[]model.Subscription] {
+	results := make([]*dataloader.Result[[]model.Subscription], len(keys))
+
+	pages := make(map[userListKey][]int)
+	for i, k := range keys {
+		page := k
+		page.user = uuid.Nil
+		pages[page] = append(pages[page], i)
+	}
+
+	for page, idx := range pages {
+		vars := filterValues(nil, &page.serviceName, &page.startDate, &page.endDate)
+		f, err := parseFilter(vars)
+		if err == nil {
+			f.UserIds = make([]uuid.UUID, 0, len(idx))
+			for _, i := range idx {
+				f.UserIds = append(f.UserIds, keys[i].user)
+			}
+			var subs []model.Subscription
+			subs, err = s.repo.SubscriptionListPerUser(ctx, f, page.limit, page.offset)
+			if err == nil {
+				byUser := make(map[uuid.UUID][]model.Subscription)
+				for _, sub := range subs {
+					byUser[sub.UserId] = append(byUser[sub.UserId], sub)
+				}
+				for _, i := range idx {
+					found := byUser[keys[i].user]
+					if found == nil {
+						found = []model.Subscription{}
+					}
+					results[i] = &dataloader.Result[[]model.Subscription]{Data: found}
+				}
+				continue
+			}
+			s.LogError("DB list error", "GraphQL", err, vars)
+			err = errGraphQLInternal
+		}
+		for _, i := range idx {
+			results[i] = &dataloader.Result[[]model.Subscription]{Error: err}
+		}
+	}
+	return results
+}
@@ -0,0 +1,568 @@
+package emsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	utils "github.com/glkeru/EM_Subscriptions/internal/utils"
+	"github.com/google/uuid"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// горизонт upcoming_charges, месяцев
+const MaxUpcomingMonths = 24
+
+// корневой резолвер: отдельные резолверы операций, иначе поле subscription
+// совпадает с методом для операции subscription
+type graphqlResolver struct {
+	s *Server
+}
+
+type queryResolver struct {
+	s *Server
+}
+
+type mutationResolver struct {
+	s *Server
+}
+
+func (r *graphqlResolver) Query() *queryResolver {
+	return &queryResolver{r.s}
+}
+
+func (r *graphqlResolver) Mutation() *mutationResolver {
+	return &mutationResolver{r.s}
+}
+
+type subscriptionsArgs struct {
+	UserID      *graphql.ID
+	ServiceName *string
+	StartDate   *string
+	EndDate     *string
+	Limit       *int32
+	Offset      *int32
+}
+
+type totalArgs struct {
+	UserID      *graphql.ID
+	ServiceName *string
+	StartDate   *string
+	EndDate     *string
+	GroupBy     *[]string
+}
+
+type subscriptionInput struct {
+	ServiceName string
+	UserID      graphql.ID
+	Price       int32
+	StartDate   string
+	EndDate     *string
+}
+
+// аргументы GraphQL как параметры запроса REST - фильтры разбираются одинаково
+func filterValues(user *graphql.ID, service, start, end *string) url.Values {
+	vars := url.Values{}
+	set := func(name string, v *string) {
+		if v != nil && *v != "" {
+			vars.Set(name, *v)
+		}
+	}
+	if user != nil {
+		set("user_id", (*string)(user))
+	}
+	set("service_name", service)
+	set("start_date", start)
+	set("end_date", end)
+	return vars
+}
+
+func pageArgs(limit, offset *int32) (int, int, error) {
+	var l, o int
+	if limit != nil {
+		l = int(*limit)
+	}
+	if offset != nil {
+		o = int(*offset)
+	}
+	if l < 0 || o < 0 {
+		return 0, 0, errors.New("limit and offset must not be negative")
+	}
+	if l == 0 {
+		l = GraphQLPageSize
+	}
+	return l, o, nil
+}
+
+func parseID(id graphql.ID) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(string(id))
+	if err != nil {
+		return uuid.Nil, errors.New("id format is wrong")
+	}
+	return parsed, nil
+}
+
+// скаляр Int64 для сумм: Int в GraphQL 32-битный
+type Int64 int64
+
+func (Int64) ImplementsGraphQLType(name string) bool {
+	return name == "Int64"
+}
+
+func (n *Int64) UnmarshalGraphQL(input any) error {
+	switch v := input.(type) {
+	case int32:
+		*n = Int64(v)
+	case int64:
+		*n = Int64(v)
+	case float64:
+		if v != math.Trunc(v) {
+			return fmt.Errorf("Int64 must be an integer, got %v", v)
+		}
+		*n = Int64(v)
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Int64 format is wrong: %q", v)
+		}
+		*n = Int64(i)
+	default:
+		return fmt.Errorf("wrong type for Int64: %T", input)
+	}
+	return nil
+}
+
+func (n Int64) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, int64(n), 10), nil
+}
+
+// ошибка репозитория для клиента: подробности только в логе
+var errGraphQLInternal = errors.New("internal error")
+
+// ошибки репозитория: не найдено - без логирования
+func (s *Server) graphqlError(msg string, err error, data any) error {
+	if errors.Is(err, model.ErrNotFound) {
+		return errors.New("subscription not found")
+	}
+	s.LogError(msg, "GraphQL", err, data)
+	return errGraphQLInternal
+}
+
+// Query
+
+func (r *queryResolver) Subscription(ctx context.Context, args struct{ ID graphql.ID }) (*subscriptionResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := r.s.repo.SubscriptionRead(ctx, id)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, r.s.graphqlError("DB read subscription", err, id)
+	}
+	return &subscriptionResolver{r.s, *sub}, nil
+}
+
+func (r *queryResolver) Subscriptions(ctx context.Context, args subscriptionsArgs) ([]*subscriptionResolver, error) {
+	vars := filterValues(args.UserID, args.ServiceName, args.StartDate, args.EndDate)
+	return r.s.graphqlList(ctx, vars, args.Limit, args.Offset)
+}
+
+func (r *queryResolver) Total(ctx context.Context, args totalArgs) (*totalResolver, error) {
+	vars := filterValues(args.UserID, args.ServiceName, args.StartDate, args.EndDate)
+	if args.GroupBy != nil {
+		vars["group_by"] = *args.GroupBy
+	}
+	f, err := parseFilter(vars)
+	if err != nil {
+		return nil, err
+	}
+	groupBy, err := parseGroupBy(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &totalResolver{groups: []model.TotalGroup{}}
+	if len(groupBy) == 0 {
+		resp.total, err = r.s.repo.SubscriptionTotal(ctx, f)
+		if err != nil {
+			return nil, r.s.graphqlError("DB total error", err, vars)
+		}
+		return resp, nil
+	}
+	resp.groups, err = r.s.repo.SubscriptionTotalGroup(ctx, f, groupBy)
+	if err != nil {
+		return nil, r.s.graphqlError("DB total group error", err, vars)
+	}
+	for _, g := range resp.groups {
+		resp.total += g.Total
+	}
+	return resp, nil
+}
+
+func (r *queryResolver) User(args struct{ ID graphql.ID }) (*userResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &userResolver{r.s, id}, nil
+}
+
+func (s *Server) graphqlList(ctx context.Context, vars url.Values, limit, offset *int32) ([]*subscriptionResolver, error) {
+	f, err := parseFilter(vars)
+	if err != nil {
+		return nil, err
+	}
+	l, o, err := pageArgs(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	subs, err := s.repo.SubscriptionList(ctx, f, l, o, model.ListOptions{})
+	if err != nil {
+		return nil, s.graphqlError("DB list error", err, vars)
+	}
+	resp := make([]*subscriptionResolver, 0, len(subs))
+	for _, sub := range subs {
+		resp = append(resp, &subscriptionResolver{s, sub})
+	}
+	return resp, nil
+}
+
+// Mutation
+
+func (r *mutationResolver) CreateSubscription(ctx context.Context, args struct{ Input subscriptionInput }) (*subscriptionResultResolver, error) {
+	sub, err := args.Input.model()
+	if err != nil {
+		return nil, err
+	}
+	sub.Id, err = r.s.repo.SubscriptionCreate(ctx, *sub)
+	if err != nil {
+		return nil, r.s.graphqlError("DB create subscription", err, sub)
+	}
+	return &subscriptionResultResolver{&subscriptionResolver{r.s, *sub}, r.s.priceWarnings(ctx, *sub)}, nil
+}
+
+func (r *mutationResolver) UpdateSubscription(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input subscriptionInput
+}) (*subscriptionResultResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := args.Input.model()
+	if err != nil {
+		return nil, err
+	}
+	sub.Id = id
+	err = r.s.repo.SubscriptionUpdate(ctx, *sub)
+	if err != nil {
+		return nil, r.s.graphqlError("DB update error", err, sub)
+	}
+	return &subscriptionResultResolver{&subscriptionResolver{r.s, *sub}, r.s.priceWarnings(ctx, *sub)}, nil
+}
+
+func (r *mutationResolver) DeleteSubscription(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return false, err
+	}
+	err = r.s.repo.SubscriptionDelete(ctx, id)
+	if err != nil {
+		return false, r.s.graphqlError("DB delete subscription", err, id)
+	}
+	return true, nil
+}
+
+// проверка как у REST: subscriptionModel
+func (in subscriptionInput) model() (*model.Subscription, error) {
+	user, err := uuid.Parse(string(in.UserID))
+	if err != nil {
+		return nil, errors.New("user_id format is wrong")
+	}
+	if in.Price <= 0 {
+		return nil, errors.New("price must be a positive integer")
+	}
+	subreq := SubscriptionFull{
+		ServiceName: in.ServiceName,
+		UserId:      user,
+		Price:       uint(in.Price),
+		StartDate:   in.StartDate,
+	}
+	if in.EndDate != nil {
+		subreq.EndDate = *in.EndDate
+	}
+	return subscriptionModel(subreq, DateFormat)
+}
+
+// Subscription
+
+type subscriptionResolver struct {
+	s   *Server
+	sub model.Subscription
+}
+
+func (r *subscriptionResolver) ID() graphql.ID {
+	return graphql.ID(r.sub.Id.String())
+}
+
+func (r *subscriptionResolver) ServiceName() string {
+	return r.sub.ServiceName
+}
+
+func (r *subscriptionResolver) UserID() graphql.ID {
+	return graphql.ID(r.sub.UserId.String())
+}
+
+func (r *subscriptionResolver) Price() int32 {
+	return int32(r.sub.Price)
+}
+
+func (r *subscriptionResolver) StartDate() string {
+	return r.sub.StartDate.Format(DateFormat)
+}
+
+func (r *subscriptionResolver) EndDate() *string {
+	if r.sub.EndDate == nil {
+		return nil
+	}
+	end := r.sub.EndDate.Format(DateFormat)
+	return &end
+}
+
+func (r *subscriptionResolver) Category(ctx context.Context) (*string, error) {
+	return loadersFrom(ctx).categories.Load(ctx, r.sub.ServiceName)()
+}
+
+func (r *subscriptionResolver) User() *userResolver {
+	return &userResolver{r.s, r.sub.UserId}
+}
+
+// User
+
+type userResolver struct {
+	s  *Server
+	id uuid.UUID
+}
+
+func (r *userResolver) ID() graphql.ID {
+	return graphql.ID(r.id.String())
+}
+
+func (r *userResolver) Subscriptions(ctx context.Context, args struct {
+	ServiceName *string
+	StartDate   *string
+	EndDate     *string
+	Limit       *int32
+	Offset      *int32
+}) ([]*subscriptionResolver, error) {
+	// фильтр и страница проверяются заранее, чтобы ошибка формата не ушла в пакет
+	_, err := parseFilter(filterValues(nil, args.ServiceName, args.StartDate, args.EndDate))
+	if err != nil {
+		return nil, err
+	}
+	key := userListKey{user: r.id}
+	key.limit, key.offset, err = pageArgs(args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+	if args.ServiceName != nil {
+		key.serviceName = *args.ServiceName
+	}
+	if args.StartDate != nil {
+		key.startDate = *args.StartDate
+	}
+	if args.EndDate != nil {
+		key.endDate = *args.EndDate
+	}
+	subs, err := loadersFrom(ctx).subscriptions.Load(ctx, key)()
+	if err != nil {
+		return nil, err
+	}
+	resp := make([]*subscriptionResolver, 0, len(subs))
+	for _, sub := range subs {
+		resp = append(resp, &subscriptionResolver{r.s, sub})
+	}
+	return resp, nil
+}
+
+func (r *userResolver) Total(ctx context.Context, args struct {
+	ServiceName *string
+	StartDate   *string
+	EndDate     *string
+}) (Int64, error) {
+	groups, err := r.services(ctx, args.ServiceName, args.StartDate, args.EndDate)
+	if err != nil {
+		return 0, err
+	}
+	var total uint
+	for _, g := range groups {
+		total += g.Total
+	}
+	return Int64(total), nil
+}
+
+func (r *userResolver) Services(ctx context.Context, args struct {
+	StartDate *string
+	EndDate   *string
+}) ([]*totalGroupResolver, error) {
+	groups, err := r.services(ctx, nil, args.StartDate, args.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	resp := make([]*totalGroupResolver, 0, len(groups))
+	for _, g := range groups {
+		// пользователь известен из родительского поля
+		g.UserId = nil
+		resp = append(resp, &totalGroupResolver{g})
+	}
+	return resp, nil
+}
+
+// суммы по сервисам через загрузчик; ключ проверяется заранее, чтобы ошибка формата не ушла в пакет
+func (r *userResolver) services(ctx context.Context, service, start, end *string) ([]model.TotalGroup, error) {
+	_, err := parseFilter(filterValues(nil, service, start, end))
+	if err != nil {
+		return nil, err
+	}
+	key := userTotalKey{user: r.id}
+	if service != nil {
+		key.serviceName = *service
+	}
+	if start != nil {
+		key.startDate = *start
+	}
+	if end != nil {
+		key.endDate = *end
+	}
+	return loadersFrom(ctx).services.Load(ctx, key)()
+}
+
+func (r *userResolver) UpcomingCharges(ctx context.Context, args struct{ Months int32 }) ([]*chargeResolver, error) {
+	if args.Months < 1 || args.Months > MaxUpcomingMonths {
+		return nil, errors.New("months must be between 1 and 24")
+	}
+	month := utils.MonthStart(time.Now())
+	last := month.AddDate(0, int(args.Months)-1, 0)
+	subs, err := r.s.listAll(ctx, r.id, "", &month, &last)
+	if err != nil {
+		return nil, r.s.graphqlError("DB list error", err, r.id)
+	}
+
+	charges := make([]*chargeResolver, 0)
+	for m := month; !m.After(last); m = m.AddDate(0, 1, 0) {
+		for _, sub := range subs {
+			if sub.StartDate.After(m) || (sub.EndDate != nil && sub.EndDate.Before(m)) {
+				continue
+			}
+			charges = append(charges, &chargeResolver{m, sub})
+		}
+	}
+	sort.SliceStable(charges, func(i, j int) bool {
+		if !charges[i].month.Equal(charges[j].month) {
+			return charges[i].month.Before(charges[j].month)
+		}
+		return charges[i].sub.ServiceName < charges[j].sub.ServiceName
+	})
+	return charges, nil
+}
+
+// Total
+
+type totalResolver struct {
+	total  uint
+	groups []model.TotalGroup
+}
+
+func (r *totalResolver) Total() Int64 {
+	return Int64(r.total)
+}
+
+func (r *totalResolver) Groups() []*totalGroupResolver {
+	resp := make([]*totalGroupResolver, 0, len(r.groups))
+	for _, g := range r.groups {
+		resp = append(resp, &totalGroupResolver{g})
+	}
+	return resp
+}
+
+type totalGroupResolver struct {
+	g model.TotalGroup
+}
+
+func (r *totalGroupResolver) ServiceName() *string {
+	return r.g.ServiceName
+}
+
+func (r *totalGroupResolver) UserID() *graphql.ID {
+	if r.g.UserId == nil {
+		return nil
+	}
+	id := graphql.ID(r.g.UserId.String())
+	return &id
+}
+
+func (r *totalGroupResolver) Month() *string {
+	if r.g.Month == nil {
+		return nil
+	}
+	month := r.g.Month.Format(DateFormat)
+	return &month
+}
+
+func (r *totalGroupResolver) Total() Int64 {
+	return Int64(r.g.Total)
+}
+
+func (r *totalGroupResolver) Count() int32 {
+	return int32(r.g.Count)
+}
+
+// Charge
+
+type chargeResolver struct {
+	month time.Time
+	sub   model.Subscription
+}
+
+func (r *chargeResolver) Month() string {
+	return r.month.Format(DateFormat)
+}
+
+func (r *chargeResolver) SubscriptionID() graphql.ID {
+	return graphql.ID(r.sub.Id.String())
+}
+
+func (r *chargeResolver) ServiceName() string {
+	return r.sub.ServiceName
+}
+
+func (r *chargeResolver) Price() int32 {
+	return int32(r.sub.Price)
+}
+
+// SubscriptionResult
+
+type subscriptionResultResolver struct {
+	sub      *subscriptionResolver
+	warnings []string
+}
+
+func (r *subscriptionResultResolver) Subscription() *subscriptionResolver {
+	return r.sub
+}
+
+func (r *subscriptionResultResolver) Warnings() []string {
+	if r.warnings == nil {
+		return []string{}
+	}
+	return r.warnings
+}
@@ -0,0 +1,168 @@
+package emsub
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+)
+
+// запрос с ключом, не завершившийся за это время (упал процесс), можно выполнить заново
+const IdempotencyLockTimeout = time.Minute
+
+const MaxIdempotencyKey = 255
+
+// Idempotency-Key для POST: повтор запроса с тем же ключом получает сохраненный ответ,
+// тот же ключ с другим запросом (параметры, Content-Type, тело) - 422. Ответы с ошибкой не сохраняются: ключ освобождается,
+// запрос можно повторить, в том числе с исправленным телом
+func (s *Server) Idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get("Idempotency-Key")
+		if key == "" || s.config.IdempotencyTTL <= 0 {
+			next(w, req)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			s.LogError("Idempotency-Key format is wrong", "Idempotent", nil, key)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "Idempotency-Key must be 1-255 printable ASCII characters"))
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			s.LogError("get request body", "Idempotent", err, nil)
+			s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
+			return
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		rec := model.IdempotencyRecord{
+			Scope:       req.Method + " " + req.URL.Path,
+			Key:         key,
+			RequestHash: requestHash(req, body),
+		}
+		ttl := time.Duration(s.config.IdempotencyTTL) * time.Hour
+		saved, err := s.repo.IdempotencyStart(req.Context(), &rec, ttl, IdempotencyLockTimeout)
+		if err != nil {
+			s.LogError("DB idempotency key error", "Idempotent", err, rec)
+			s.writeError(w, req, ErrInternal)
+			return
+		}
+		if saved != nil {
+			s.replay(w, req, rec, saved)
+			return
+		}
+
+		// ответ сохраняется и при обрыве соединения клиентом - как раз для его повтора
+		ctx := context.WithoutCancel(req.Context())
+		rw := &idempotencyWriter{ResponseWriter: w}
+		stored := false
+		defer func() {
+			if !stored {
+				err := s.repo.IdempotencyDelete(ctx, rec)
+				if err != nil {
+					s.LogError("DB idempotency key error", "Idempotent", err, rec.Key)
+				}
+			}
+		}()
+
+		next(rw, req)
+
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		if rw.status >= http.StatusBadRequest {
+			return
+		}
+		rec.Status = rw.status
+		rec.ContentType = rw.Header().Get("Content-Type")
+		rec.Body = rw.body.Bytes()
+		err = s.repo.IdempotencySave(ctx, rec)
+		if errors.Is(err, model.ErrNotFound) {
+			// ключ перезаписан повтором после истечения блокировки: ответ не сохранен
+			s.LogError("Idempotency-Key lost", "Idempotent", err, rec.Key)
+			return
+		}
+		if err != nil {
+			s.LogError("DB idempotency key error", "Idempotent", err, rec.Key)
+			return
+		}
+		stored = true
+	}
+}
+
+// сохраненный ответ для повтора запроса
+func (s *Server) replay(w http.ResponseWriter, req *http.Request, rec model.IdempotencyRecord, saved *model.IdempotencyRecord) {
+	if saved.RequestHash != rec.RequestHash {
+		s.LogError("Idempotency-Key reused", "Idempotent", nil, rec.Key)
+		s.writeError(w, req, NewError(CodeIdempotencyReused, "Idempotency-Key was already used with a different request"))
+		return
+	}
+	if saved.Status == 0 {
+		s.writeError(w, req, NewError(CodeIdempotencyInUse, "request with this Idempotency-Key is still in progress"))
+		return
+	}
+
+	if saved.ContentType != "" {
+		w.Header().Set("Content-Type", saved.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(saved.Status)
+	w.Write(saved.Body)
+}
+
+// хеш всего, что влияет на результат: параметры запроса, Content-Type и тело
+func requestHash(req *http.Request, body []byte) string {
+	h := sha256.New()
+	for _, part := range []string{req.URL.RawQuery, req.Header.Get("Content-Type")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > MaxIdempotencyKey {
+		return false
+	}
+	for _, c := range key {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// копия ответа обработчика для сохранения
+type idempotencyWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *idempotencyWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *idempotencyWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *idempotencyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,293 @@
+package emsub
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/google/uuid"
+)
+
+// статусы строк импорта
+const (
+	ImportCreated = "created"
+	ImportSkipped = "skipped"
+	ImportFailed  = "failed"
+)
+
+// загрузка и разбор большого файла дольше ReadTimeout/WriteTimeout сервера
+const ImportTimeout = 10 * time.Minute
+
+// поля подписки в CSV, end_date - необязательное
+var importFields = []string{"service_name", "user_id", "price", "start_date", "end_date"}
+
+// Import CSV
+func (s *Server) SubscriptionImportCSV(w http.ResponseWriter, req *http.Request) {
+	vars := req.URL.Query()
+	dryRun := vars.Get("dry_run") == "true"
+
+	layout := vars.Get("date_format")
+	if layout == "" {
+		layout = DateFormat
+	}
+	mapping, err := parseColumns(vars.Get("columns"))
+	if err != nil {
+		s.LogError("columns format is wrong", "SubscriptionImportCSV", err, vars)
+		s.writeError(w, req, NewError(CodeInvalidParameter, err.Error()))
+		return
+	}
+	delimiter := ','
+	if str := vars.Get("delimiter"); str != "" {
+		r, size := utf8.DecodeRuneInString(str)
+		if size != len(str) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+			s.LogError("delimiter format is wrong", "SubscriptionImportCSV", nil, vars)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "delimiter must be a single character"))
+			return
+		}
+		delimiter = r
+	}
+
+	// без этого соединение обрывается посреди файла, часть строк уже создана, а отчета клиент не получит
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(ImportTimeout)
+	err = rc.SetReadDeadline(deadline)
+	if err == nil {
+		err = rc.SetWriteDeadline(deadline)
+	}
+	if err != nil {
+		s.LogError("set deadline", "SubscriptionImportCSV", err, nil)
+	}
+
+	// файл читается потоком: тело целиком или поле file из multipart/form-data
+	body, err := importBody(req)
+	if err != nil {
+		s.LogError("get request body", "SubscriptionImportCSV", err, nil)
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
+		return
+	}
+	defer req.Body.Close()
+
+	reader := csv.NewReader(body)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		s.LogError("CSV header error", "SubscriptionImportCSV", err, nil)
+		s.writeError(w, req, NewError(CodeInvalidBody, "CSV header is required"))
+		return
+	}
+	index, err := importIndex(header, mapping)
+	if err != nil {
+		s.LogError("CSV header error", "SubscriptionImportCSV", err, header)
+		s.writeError(w, req, NewError(CodeInvalidBody, err.Error()))
+		return
+	}
+
+	resp := &ImportResponse{DryRun: dryRun, Rows: make([]ImportRow, 0)}
+	seen := make(map[string]int)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// ошибка разбора - строка не принята, ошибка чтения - импорт прерывается
+			var perr *csv.ParseError
+			if !errors.As(err, &perr) {
+				s.LogError("CSV read error", "SubscriptionImportCSV", err, nil)
+				resp.add(ImportRow{Status: ImportFailed, Reason: "read error, import interrupted"})
+				break
+			}
+			resp.add(ImportRow{Row: perr.StartLine, Status: ImportFailed, Reason: perr.Err.Error()})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		row := ImportRow{Row: line}
+
+		subs, err := importSubscription(record, index, layout)
+		if err != nil {
+			row.Status, row.Reason = ImportFailed, err.Error()
+			resp.add(row)
+			continue
+		}
+
+		// дубликаты в файле и уже существующие подписки пропускаем
+		key := importKey(*subs)
+		if first, ok := seen[key]; ok {
+			row.Status, row.Reason = ImportSkipped, fmt.Sprintf("duplicate of row %d", first)
+			resp.add(row)
+			continue
+		}
+		seen[key] = row.Row
+		exists, err := s.repo.SubscriptionExists(req.Context(), *subs)
+		if err != nil {
+			s.LogError("DB exists error", "SubscriptionImportCSV", err, subs)
+			row.Status, row.Reason = ImportFailed, "database error"
+			resp.add(row)
+			continue
+		}
+		if exists {
+			row.Status, row.Reason = ImportSkipped, "subscription already exists"
+			resp.add(row)
+			continue
+		}
+
+		if !dryRun {
+			id, err := s.repo.SubscriptionCreate(req.Context(), *subs)
+			if err != nil {
+				s.LogError("DB create subscription", "SubscriptionImportCSV", err, subs)
+				row.Status, row.Reason = ImportFailed, "database error"
+				resp.add(row)
+				continue
+			}
+			row.Id = &id
+		}
+		row.Status = ImportCreated
+		resp.add(row)
+	}
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "SubscriptionImportCSV", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+func (resp *ImportResponse) add(row ImportRow) {
+	switch row.Status {
+	case ImportCreated:
+		resp.Created++
+	case ImportSkipped:
+		resp.Skipped++
+	case ImportFailed:
+		resp.Failed++
+	}
+	resp.Rows = append(resp.Rows, row)
+}
+
+// тело запроса или файл из multipart/form-data
+func importBody(req *http.Request) (io.Reader, error) {
+	ctype, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if ctype != "multipart/form-data" {
+		return req.Body, nil
+	}
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("multipart field file is required")
+			}
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+// columns=service_name:Сервис,price:Стоимость - названия колонок файла для полей подписки
+func parseColumns(str string) (map[string]string, error) {
+	mapping := make(map[string]string, len(importFields))
+	for _, f := range importFields {
+		mapping[f] = f
+	}
+	if str == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(str, ",") {
+		field, column, ok := strings.Cut(pair, ":")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || column == "" {
+			return nil, fmt.Errorf("column mapping %q must be field:column", pair)
+		}
+		if _, ok := mapping[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+// номера колонок полей по заголовку, регистр и пробелы не важны
+func importIndex(header []string, mapping map[string]string) (map[string]int, error) {
+	columns := make(map[string]int, len(header))
+	for i, h := range header {
+		if i == 0 {
+			h = strings.TrimPrefix(h, "\ufeff") // BOM из Excel
+		}
+		columns[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+
+	index := make(map[string]int, len(importFields))
+	for _, f := range importFields {
+		i, ok := columns[strings.ToLower(mapping[f])]
+		if !ok {
+			if f == "end_date" {
+				continue
+			}
+			return nil, fmt.Errorf("column %q for %s not found in header", mapping[f], f)
+		}
+		index[f] = i
+	}
+	return index, nil
+}
+
+// строка CSV в подписку по тем же правилам, что и SubscriptionCreate
+func importSubscription(record []string, index map[string]int, layout string) (*model.Subscription, error) {
+	value := func(f string) string {
+		i, ok := index[f]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var subreq SubscriptionFull
+	subreq.ServiceName = value("service_name")
+	subreq.StartDate = value("start_date")
+	subreq.EndDate = value("end_date")
+	if str := value("user_id"); str != "" {
+		user, err := uuid.Parse(str)
+		if err != nil {
+			return nil, errors.New("user_id format is wrong")
+		}
+		subreq.UserId = user
+	}
+	if str := value("price"); str != "" {
+		price, err := strconv.ParseUint(str, 10, 31)
+		if err != nil {
+			return nil, errors.New("price must be a positive integer")
+		}
+		subreq.Price = uint(price)
+	}
+	return subscriptionModel(subreq, layout)
+}
+
+// ключ подписки для поиска дубликатов в файле
+func importKey(sub model.Subscription) string {
+	end := ""
+	if sub.EndDate != nil {
+		end = sub.EndDate.Format(DateFormat)
+	}
+	return fmt.Sprintf("%s|%s|%d|%s|%s", sub.UserId, sub.ServiceName, sub.Price, sub.StartDate.Format(DateFormat), end)
+}
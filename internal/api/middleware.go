@@ -2,16 +2,43 @@ package emsub
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	config "github.com/glkeru/EM_Subscriptions/internal/config"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
 const MaxBody = 1024
 
+// длиннее - заменяется своим, чтобы в лог и ответ не попадало что угодно
+const MaxRequestId = 128
+
+type requestIdKey struct{}
+
+// X-Request-ID запроса: из заголовка клиента или сгенерированный
+func RequestId(ctx context.Context) string {
+	rid, _ := ctx.Value(requestIdKey{}).(string)
+	return rid
+}
+
+func requestId(r *http.Request) string {
+	rid := r.Header.Get("X-Request-ID")
+	if rid == "" || len(rid) > MaxRequestId {
+		return uuid.NewString()
+	}
+	for _, c := range rid {
+		if c < 0x21 || c > 0x7e {
+			return uuid.NewString()
+		}
+	}
+	return rid
+}
+
 // логируем вызовы
 type logResponseWriter struct {
 	http.ResponseWriter
@@ -22,26 +49,39 @@ func (w *logResponseWriter) WriteHeader(code int) {
 	w.status = code
 	w.ResponseWriter.WriteHeader(code)
 }
+
+// для http.ResponseController: Flush, SetWriteDeadline исходного writer
+func (w *logResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// копия первых MaxBody байт тела по мере чтения обработчиком, тело не обрезается
+type logBodyReader struct {
+	io.ReadCloser
+	buf bytes.Buffer
+}
+
+func (b *logBodyReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if rest := MaxBody - b.buf.Len(); rest > 0 && n > 0 {
+		b.buf.Write(p[:min(n, rest)])
+	}
+	return n, err
+}
 func MiddlewareLog(logger *zap.Logger, c *config.Config) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 			reqtime := time.Now()
-			rid := r.Header.Get("X-Request-ID")
+			rid := requestId(r)
+			r = r.WithContext(context.WithValue(r.Context(), requestIdKey{}, rid))
+			w.Header().Set("X-Request-ID", rid)
 
 			// логируем тело запроса, если включено
-			var logbody []byte
-			if c.LogBody {
-				savebody, err := io.ReadAll(r.Body)
-				if err == nil {
-					_ = r.Body.Close()
-					if len(savebody) > MaxBody {
-						logbody = savebody[:MaxBody]
-					} else {
-						logbody = savebody
-					}
-					r.Body = io.NopCloser(bytes.NewReader(logbody))
-				}
+			var logbody *logBodyReader
+			if c.LogBody && r.Body != nil {
+				logbody = &logBodyReader{ReadCloser: r.Body}
+				r.Body = logbody
 			}
 
 			logrw := &logResponseWriter{w, 200}
@@ -51,13 +91,38 @@ func MiddlewareLog(logger *zap.Logger, c *config.Config) func(http.Handler) http
 				zap.String("rid", rid),
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path),
-				zap.String("query", r.URL.RawQuery),
+				zap.String("query", loggedQuery(r.URL)),
 				zap.Int("status", logrw.status),
 				zap.Duration("dur", time.Since(reqtime)),
 				zap.String("ip", r.RemoteAddr),
 				zap.String("ua", r.UserAgent()),
-				zap.String("body", string(logbody)),
+				zap.String("body", loggedBody(logbody)),
 			)
 		})
 	}
 }
+
+// параметры-секреты, в лог идут замаскированными
+var secretParams = []string{"token"}
+
+func loggedQuery(u *url.URL) string {
+	q := u.Query()
+	masked := false
+	for _, p := range secretParams {
+		if q.Has(p) {
+			q.Set(p, "***")
+			masked = true
+		}
+	}
+	if !masked {
+		return u.RawQuery
+	}
+	return q.Encode()
+}
+
+func loggedBody(b *logBodyReader) string {
+	if b == nil {
+		return ""
+	}
+	return b.buf.String()
+}
@@ -0,0 +1,204 @@
+package emsub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"strconv"
+	"strings"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	validate "github.com/glkeru/EM_Subscriptions/internal/validate"
+)
+
+const (
+	ContentTypeMergePatch = "application/merge-patch+json" // RFC 7396
+	ContentTypeJSONPatch  = "application/json-patch+json"  // RFC 6902
+)
+
+// поля, которые разрешено менять через PATCH
+var patchFields = []string{"service_name", "user_id", "price", "start_date", "end_date"}
+
+// операция JSON Patch
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// разбор JSON Merge Patch в типизированный патч
+func parseMergePatch(doc map[string]json.RawMessage) (model.SubscriptionPatch, error) {
+	for k := range doc {
+		if !isPatchField(k) {
+			return model.SubscriptionPatch{}, fmt.Errorf("unknown field %q", k)
+		}
+	}
+
+	// здесь проверяются только типы JSON, значения - в validate.Patch
+	var in validate.PatchInput
+	if v, ok := doc["service_name"]; ok {
+		var str string
+		if isNull(v) || json.Unmarshal(v, &str) != nil {
+			return model.SubscriptionPatch{}, errors.New("service_name must be a non-empty string")
+		}
+		in.ServiceName = &str
+	}
+	if v, ok := doc["user_id"]; ok {
+		var str string
+		if isNull(v) || json.Unmarshal(v, &str) != nil {
+			return model.SubscriptionPatch{}, errors.New("user_id must be a UUID string")
+		}
+		in.UserId = &str
+	}
+	if v, ok := doc["price"]; ok {
+		// только целое число, не 1.0 и не строка
+		var val any
+		dec := json.NewDecoder(bytes.NewReader(v))
+		dec.UseNumber()
+		if dec.Decode(&val) != nil {
+			return model.SubscriptionPatch{}, errors.New("price must be a positive integer")
+		}
+		num, ok := val.(json.Number)
+		if !ok {
+			return model.SubscriptionPatch{}, errors.New("price must be a positive integer")
+		}
+		price, err := strconv.ParseUint(num.String(), 10, 64)
+		if err != nil {
+			return model.SubscriptionPatch{}, errors.New("price must be a positive integer")
+		}
+		in.Price = &price
+	}
+	if v, ok := doc["start_date"]; ok {
+		var str string
+		if isNull(v) || json.Unmarshal(v, &str) != nil {
+			return model.SubscriptionPatch{}, errors.New("start_date must be a string in MM-YYYY format")
+		}
+		in.StartDate = &str
+	}
+	if v, ok := doc["end_date"]; ok {
+		// null сбрасывает дату окончания
+		if isNull(v) {
+			in.ClearEnd = true
+		} else {
+			var str string
+			if json.Unmarshal(v, &str) != nil {
+				return model.SubscriptionPatch{}, errors.New("end_date must be a string in MM-YYYY format or null")
+			}
+			in.EndDate = &str
+		}
+	}
+
+	return validate.Patch(in)
+}
+
+// применение JSON Patch к текущему документу подписки, возвращает изменения в виде merge patch
+func applyJSONPatch(sub model.Subscription, ops []jsonPatchOp) (map[string]json.RawMessage, error) {
+	orig, err := subscriptionDoc(sub)
+	if err != nil {
+		return nil, err
+	}
+	doc := maps.Clone(orig)
+
+	for i, op := range ops {
+		path, err := patchPointer(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+		switch op.Op {
+		case "add", "replace":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d: value is required", i)
+			}
+			if _, ok := doc[path]; !ok && op.Op == "replace" {
+				return nil, fmt.Errorf("operation %d: path %q not found", i, op.Path)
+			}
+			doc[path] = op.Value
+		case "remove":
+			if _, ok := doc[path]; !ok {
+				return nil, fmt.Errorf("operation %d: path %q not found", i, op.Path)
+			}
+			delete(doc, path)
+		case "move", "copy":
+			from, err := patchPointer(op.From)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			v, ok := doc[from]
+			if !ok {
+				return nil, fmt.Errorf("operation %d: path %q not found", i, op.From)
+			}
+			if op.Op == "move" {
+				delete(doc, from)
+			}
+			doc[path] = v
+		case "test":
+			v, ok := doc[path]
+			if !ok || op.Value == nil || !jsonEqual(v, op.Value) {
+				return nil, fmt.Errorf("operation %d: test failed for path %q", i, op.Path)
+			}
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i, op.Op)
+		}
+	}
+
+	// оставляем только изменившиеся поля, удаленные передаем как null
+	diff := make(map[string]json.RawMessage)
+	for k, v := range doc {
+		if ov, ok := orig[k]; !ok || !jsonEqual(ov, v) {
+			diff[k] = v
+		}
+	}
+	for k := range orig {
+		if _, ok := doc[k]; !ok {
+			diff[k] = json.RawMessage("null")
+		}
+	}
+	return diff, nil
+}
+
+// текущая подписка в виде JSON документа (без id)
+func subscriptionDoc(sub model.Subscription) (map[string]json.RawMessage, error) {
+	b, err := json.Marshal(subscriptionFull(sub))
+	if err != nil {
+		return nil, err
+	}
+	doc := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	delete(doc, "id")
+	return doc, nil
+}
+
+// JSON Pointer: поддерживаются только поля верхнего уровня
+func patchPointer(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") || strings.Count(p, "/") != 1 {
+		return "", fmt.Errorf("unsupported path %q", p)
+	}
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(p[1:]), nil
+}
+
+func isPatchField(k string) bool {
+	for _, f := range patchFields {
+		if f == k {
+			return true
+		}
+	}
+	return false
+}
+
+func isNull(v json.RawMessage) bool {
+	return string(bytes.TrimSpace(v)) == "null"
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
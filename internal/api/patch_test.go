@@ -0,0 +1,147 @@
+package emsub
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/google/uuid"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func month(m time.Month, y int) time.Time {
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+var (
+	patchUser  = uuid.MustParse("60601fee-2bf1-4721-ae6f-7636e79a0cba")
+	patchUser2 = uuid.MustParse("7f2c1c4e-1b9a-4d35-9c8e-2f4b8b0b8f11")
+)
+
+func TestParseMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		patch model.SubscriptionPatch
+		err   string
+	}{
+		{"service", `{"service_name":"Okko"}`, model.SubscriptionPatch{ServiceName: ptr("Okko")}, ""},
+		{"user", `{"user_id":"` + patchUser2.String() + `"}`, model.SubscriptionPatch{UserId: &patchUser2}, ""},
+		{"price", `{"price":400}`, model.SubscriptionPatch{Price: ptr(uint(400))}, ""},
+		{"dates", `{"start_date":"07-2025","end_date":"12-2025"}`, model.SubscriptionPatch{StartDate: ptr(month(7, 2025)), EndDate: ptr(month(12, 2025))}, ""},
+		{"clear end", `{"end_date":null}`, model.SubscriptionPatch{ClearEnd: true}, ""},
+
+		{"unknown field", `{"id":"x"}`, model.SubscriptionPatch{}, `unknown field "id"`},
+		{"empty service", `{"service_name":""}`, model.SubscriptionPatch{}, "service_name must be a non-empty string"},
+		{"null service", `{"service_name":null}`, model.SubscriptionPatch{}, "service_name must be a non-empty string"},
+		{"nil user", `{"user_id":"00000000-0000-0000-0000-000000000000"}`, model.SubscriptionPatch{}, "user_id must be a UUID string"},
+		{"user not string", `{"user_id":1}`, model.SubscriptionPatch{}, "user_id must be a UUID string"},
+		{"zero price", `{"price":0}`, model.SubscriptionPatch{}, "price must be a positive integer"},
+		{"negative price", `{"price":-1}`, model.SubscriptionPatch{}, "price must be a positive integer"},
+		{"fractional price", `{"price":1.5}`, model.SubscriptionPatch{}, "price must be a positive integer"},
+		{"string price", `{"price":"1"}`, model.SubscriptionPatch{}, "price must be a positive integer"},
+		{"price over int", `{"price":2147483648}`, model.SubscriptionPatch{}, "price must be a positive integer"},
+		{"bad start", `{"start_date":"2025-07"}`, model.SubscriptionPatch{}, "start_date must be a string in MM-YYYY format"},
+		{"null start", `{"start_date":null}`, model.SubscriptionPatch{}, "start_date must be a string in MM-YYYY format"},
+		{"bad end", `{"end_date":"13-2025"}`, model.SubscriptionPatch{}, "end_date must be a string in MM-YYYY format or null"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := make(map[string]json.RawMessage)
+			if err := json.Unmarshal([]byte(tt.body), &doc); err != nil {
+				t.Fatal(err)
+			}
+			p, err := parseMergePatch(doc)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if !reflect.DeepEqual(p, tt.patch) {
+				t.Errorf("patch = %+v, want %+v", p, tt.patch)
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	end := month(12, 2025)
+	sub := model.Subscription{
+		Id:          uuid.New(),
+		ServiceName: "Yandex Plus",
+		UserId:      patchUser,
+		Price:       400,
+		StartDate:   month(7, 2025),
+		EndDate:     &end,
+	}
+	noEnd := sub
+	noEnd.EndDate = nil
+
+	tests := []struct {
+		name  string
+		sub   model.Subscription
+		ops   string
+		patch model.SubscriptionPatch
+		err   string
+	}{
+		{"replace", sub, `[{"op":"replace","path":"/price","value":500}]`, model.SubscriptionPatch{Price: ptr(uint(500))}, ""},
+		{"test then replace", sub, `[{"op":"test","path":"/price","value":400},{"op":"replace","path":"/price","value":500}]`, model.SubscriptionPatch{Price: ptr(uint(500))}, ""},
+		// значение, равное текущему, в патч не попадает
+		{"same value", sub, `[{"op":"replace","path":"/service_name","value":"Yandex Plus"}]`, model.SubscriptionPatch{}, ""},
+		{"only test", sub, `[{"op":"test","path":"/service_name","value":"Yandex Plus"}]`, model.SubscriptionPatch{}, ""},
+		{"remove end", sub, `[{"op":"remove","path":"/end_date"}]`, model.SubscriptionPatch{ClearEnd: true}, ""},
+		{"add end", noEnd, `[{"op":"add","path":"/end_date","value":"01-2026"}]`, model.SubscriptionPatch{EndDate: ptr(month(1, 2026))}, ""},
+		{"copy", sub, `[{"op":"copy","from":"/start_date","path":"/end_date"}]`, model.SubscriptionPatch{EndDate: ptr(month(7, 2025))}, ""},
+		{"move", sub, `[{"op":"move","from":"/end_date","path":"/start_date"}]`, model.SubscriptionPatch{StartDate: ptr(month(12, 2025)), ClearEnd: true}, ""},
+
+		{"test failed", sub, `[{"op":"test","path":"/price","value":500},{"op":"replace","path":"/price","value":600}]`, model.SubscriptionPatch{}, "operation 0: test failed"},
+		{"replace missing", noEnd, `[{"op":"replace","path":"/end_date","value":"01-2026"}]`, model.SubscriptionPatch{}, `operation 0: path "/end_date" not found`},
+		{"remove missing", noEnd, `[{"op":"remove","path":"/end_date"}]`, model.SubscriptionPatch{}, `path "/end_date" not found`},
+		{"move missing", noEnd, `[{"op":"move","from":"/end_date","path":"/start_date"}]`, model.SubscriptionPatch{}, `path "/end_date" not found`},
+		{"no value", sub, `[{"op":"replace","path":"/price"}]`, model.SubscriptionPatch{}, "value is required"},
+		{"nested path", sub, `[{"op":"replace","path":"/price/x","value":1}]`, model.SubscriptionPatch{}, `unsupported path "/price/x"`},
+		{"relative path", sub, `[{"op":"replace","path":"price","value":1}]`, model.SubscriptionPatch{}, `unsupported path "price"`},
+		{"unknown op", sub, `[{"op":"increment","path":"/price","value":1}]`, model.SubscriptionPatch{}, `operation 0: unknown op "increment"`},
+		{"second op", sub, `[{"op":"replace","path":"/price","value":500},{"op":"nope","path":"/price"}]`, model.SubscriptionPatch{}, "operation 1:"},
+		// ошибки значений - от parseMergePatch
+		{"unknown field", sub, `[{"op":"add","path":"/category","value":"video"}]`, model.SubscriptionPatch{}, `unknown field "category"`},
+		{"remove required", sub, `[{"op":"remove","path":"/service_name"}]`, model.SubscriptionPatch{}, "service_name must be a non-empty string"},
+		{"bad price", sub, `[{"op":"replace","path":"/price","value":0}]`, model.SubscriptionPatch{}, "price must be a positive integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []jsonPatchOp
+			if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+				t.Fatal(err)
+			}
+			// как в SubscriptionPatch: изменения проверяются разбором merge patch
+			diff, err := applyJSONPatch(tt.sub, ops)
+			var p model.SubscriptionPatch
+			if err == nil {
+				p, err = parseMergePatch(diff)
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if !reflect.DeepEqual(p, tt.patch) {
+				t.Errorf("patch = %+v, want %+v", p, tt.patch)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package emsub
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	filter "github.com/glkeru/EM_Subscriptions/internal/filter"
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	validate "github.com/glkeru/EM_Subscriptions/internal/validate"
+)
+
+// фильтры user_id, service_name, start_date, end_date из query
+func parseFilter(vars url.Values) (model.Filter, error) {
+	return validate.Filter(vars.Get("user_id"), vars.Get("service_name"), vars.Get("start_date"), vars.Get("end_date"))
+}
+
+// выражение filter, nil - не задано
+func parseFilterExpr(vars url.Values) (model.FilterExpr, error) {
+	src := vars.Get("filter")
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	return filter.Parse(src)
+}
+
+// sort: ключи через запятую, "-" перед полем - по убыванию
+func parseSort(vars url.Values) ([]model.SortKey, error) {
+	keys := make([]model.SortKey, 0)
+	seen := make(map[string]bool)
+	for _, v := range strings.Split(vars.Get("sort"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		k := model.SortKey{Field: strings.TrimPrefix(v, "+")}
+		if strings.HasPrefix(v, "-") {
+			k = model.SortKey{Field: v[1:], Desc: true}
+		}
+		if !slices.Contains(subscriptionHeader, k.Field) {
+			return nil, fmt.Errorf("sort field %q is not allowed, allowed: %s", k.Field, strings.Join(subscriptionHeader, ", "))
+		}
+		if seen[k.Field] {
+			return nil, fmt.Errorf("sort field %q is repeated", k.Field)
+		}
+		seen[k.Field] = true
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// fields: поля ответа через запятую
+func parseFields(vars url.Values) ([]string, error) {
+	fields := make([]string, 0)
+	for _, v := range strings.Split(vars.Get("fields"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !slices.Contains(subscriptionHeader, v) {
+			return nil, fmt.Errorf("field %q is not allowed, allowed: %s", v, strings.Join(subscriptionHeader, ", "))
+		}
+		if slices.Contains(fields, v) {
+			continue
+		}
+		fields = append(fields, v)
+	}
+	return fields, nil
+}
+
+// group_by: через запятую или повтором параметра
+func parseGroupBy(vars url.Values) ([]string, error) {
+	values := make([]string, 0, 3)
+	for _, v := range vars["group_by"] {
+		for _, g := range strings.Split(v, ",") {
+			values = append(values, strings.TrimSpace(g))
+		}
+	}
+	return validate.GroupBy(values)
+}
+
+// неотрицательный процент, пустая строка - 0
+func parsePercent(v string) (float64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	p, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, err
+	}
+	if p < 0 || math.IsNaN(p) || math.IsInf(p, 0) {
+		return 0, errors.New("percentage must be non-negative")
+	}
+	return p, nil
+}
@@ -0,0 +1,220 @@
+package emsub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	utils "github.com/glkeru/EM_Subscriptions/internal/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// сколько месяцев без изменений, чтобы предложить годовой план
+const AnnualCandidateMonths = 12
+
+// подписки пользователя на один сервис
+type userService struct {
+	name  string
+	price uint      // сумма текущих цен
+	count int       // число подписок
+	start time.Time // самое раннее начало
+	open  bool      // все подписки бессрочные
+}
+
+// Recommendations
+func (s *Server) UserRecommendations(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	user, err := uuid.Parse(vars["id"])
+	if err != nil || user == uuid.Nil {
+		s.LogError("user_id format is wrong", "UserRecommendations", err, vars["id"])
+		s.writeError(w, req, NewError(CodeInvalidId, "user_id format is wrong"))
+		return
+	}
+
+	recs, err := s.recommendations(req.Context(), user)
+	if err != nil {
+		s.LogError("recommendations error", "UserRecommendations", err, user)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	resp := &RecommendationsResponse{}
+	resp.UserId = user
+	resp.Data = make([]RecommendationResponse, 0, len(recs))
+	for _, rec := range recs {
+		resp.YearlySavings += rec.YearlySavings
+		resp.Data = append(resp.Data, recommendationResponse(rec))
+	}
+
+	r, err := json.Marshal(resp)
+	if err != nil {
+		s.LogError("JSON marshal error", "UserRecommendations", err, resp)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// рекомендации по активным подпискам, экономия - по сумме SubscriptionTotal за следующие 12 месяцев
+func (s *Server) recommendations(ctx context.Context, user uuid.UUID) ([]model.Recommendation, error) {
+	month := utils.MonthStart(time.Now())
+	services, err := s.userServices(ctx, user, month)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.repo.CategoryList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	category := make(map[string]string, len(categories))
+	for _, c := range categories {
+		category[c.ServiceName] = c.Category
+	}
+
+	// стоимость сервиса на год вперед
+	start := month.AddDate(0, 1, 0)
+	end := month.AddDate(0, 12, 0)
+	yearly := make(map[string]uint, len(services))
+	for _, svc := range services {
+		yearly[svc.name], err = s.repo.SubscriptionTotal(ctx, model.Filter{UserId: user, ServiceName: svc.name, Start: &start, End: &end})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	recs := make([]model.Recommendation, 0)
+
+	// несколько сервисов одной категории: оставляем самый дешевый
+	byCategory := make(map[string][]userService)
+	for _, svc := range services {
+		if c, ok := category[svc.name]; ok {
+			byCategory[c] = append(byCategory[c], svc)
+		}
+	}
+	for c, list := range byCategory {
+		if len(list) < 2 {
+			continue
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if yearly[list[i].name] != yearly[list[j].name] {
+				return yearly[list[i].name] < yearly[list[j].name]
+			}
+			return list[i].name < list[j].name
+		})
+		for _, svc := range list[1:] {
+			rec := model.Recommendation{
+				Kind:          model.RecommendOverlap,
+				ServiceName:   svc.name,
+				Category:      c,
+				Price:         svc.price,
+				YearlyCost:    yearly[svc.name],
+				YearlySavings: yearly[svc.name],
+			}
+			for _, alt := range list {
+				if alt.name != svc.name {
+					rec.Alternatives = append(rec.Alternatives, alt.name)
+				}
+			}
+			recs = append(recs, rec)
+		}
+	}
+
+	for _, svc := range services {
+		// цена выше медианы по активным подпискам сервиса
+		stats, err := s.repo.SubscriptionPriceStats(ctx, model.Filter{ServiceName: svc.name, Start: &month, End: &month})
+		if err != nil {
+			return nil, err
+		}
+		avg := float64(svc.price) / float64(svc.count)
+		if stats.Count >= s.config.RecommendMinSamples && stats.Median > 0 && avg > stats.Median {
+			recs = append(recs, model.Recommendation{
+				Kind:          model.RecommendMedian,
+				ServiceName:   svc.name,
+				Category:      category[svc.name],
+				Price:         svc.price,
+				Median:        stats.Median,
+				YearlyCost:    yearly[svc.name],
+				YearlySavings: uint(float64(yearly[svc.name]) * (avg - stats.Median) / avg),
+			})
+		}
+
+		// давняя бессрочная подписка - кандидат на годовой план
+		months := utils.MonthsBetween(svc.start, month) - 1
+		if svc.open && months >= AnnualCandidateMonths && s.config.AnnualDiscount > 0 {
+			recs = append(recs, model.Recommendation{
+				Kind:          model.RecommendAnnual,
+				ServiceName:   svc.name,
+				Category:      category[svc.name],
+				Price:         svc.price,
+				Months:        months,
+				YearlyCost:    yearly[svc.name],
+				YearlySavings: uint(uint64(yearly[svc.name]) * uint64(s.config.AnnualDiscount) / 100),
+			})
+		}
+	}
+
+	recs = slices.DeleteFunc(recs, func(rec model.Recommendation) bool { return rec.YearlySavings == 0 })
+	sort.SliceStable(recs, func(i, j int) bool {
+		if recs[i].YearlySavings != recs[j].YearlySavings {
+			return recs[i].YearlySavings > recs[j].YearlySavings
+		}
+		return recs[i].ServiceName < recs[j].ServiceName
+	})
+	return recs, nil
+}
+
+// активные в месяце подписки пользователя, сгруппированные по сервисам
+func (s *Server) userServices(ctx context.Context, user uuid.UUID, month time.Time) ([]userService, error) {
+	subs, err := s.listAll(ctx, user, "", &month, &month)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*userService)
+	services := make([]userService, 0)
+	names := make([]string, 0)
+	for _, sub := range subs {
+		svc, ok := byName[sub.ServiceName]
+		if !ok {
+			svc = &userService{name: sub.ServiceName, start: sub.StartDate, open: true}
+			byName[sub.ServiceName] = svc
+			names = append(names, sub.ServiceName)
+		}
+		svc.price += sub.Price
+		svc.count++
+		if sub.StartDate.Before(svc.start) {
+			svc.start = sub.StartDate
+		}
+		if sub.EndDate != nil {
+			svc.open = false
+		}
+	}
+	for _, name := range names {
+		services = append(services, *byName[name])
+	}
+	return services, nil
+}
+
+// все подписки пользователя (и сервиса) за период: курсором в одном снимке,
+// страницы по OFFSET могли пропускать и повторять строки
+func (s *Server) listAll(ctx context.Context, user uuid.UUID, service_name string, start *time.Time, end *time.Time) ([]model.Subscription, error) {
+	all := make([]model.Subscription, 0)
+	f := model.Filter{UserId: user, ServiceName: service_name, Start: start, End: end}
+	err := s.repo.SubscriptionExport(ctx, f, func(sub model.Subscription) error {
+		all = append(all, sub)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
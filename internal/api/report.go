@@ -0,0 +1,205 @@
+package emsub
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"html/template"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+//go:embed templates/report.html
+var templatesFS embed.FS
+
+var reportTemplate = template.Must(template.ParseFS(templatesFS, "templates/report.html"))
+
+// размеры графика в отчете, px
+const (
+	chartWidth  = 720
+	chartHeight = 232
+	chartPad    = 24 // отступ слева и справа
+	chartTop    = 20 // место над столбцом под подпись суммы
+	chartPlot   = 180
+	chartBar    = 40
+)
+
+// данные для шаблона отчета
+type reportPage struct {
+	*UserReportResponse
+	Chart reportChart
+}
+
+type reportChart struct {
+	Width  int
+	Height int
+	LabelY int
+	Bars   []reportBar
+}
+
+type reportBar struct {
+	X, Y, Width, Height int
+	LabelX, ValueY      int
+	Label               string
+	Total               uint
+}
+
+// Report
+func (s *Server) UserReport(w http.ResponseWriter, req *http.Request) {
+	user, err := uuid.Parse(mux.Vars(req)["id"])
+	if err != nil || user == uuid.Nil {
+		s.LogError("user_id format is wrong", "UserReport", err, mux.Vars(req)["id"])
+		s.writeError(w, req, NewError(CodeInvalidId, "user_id format is wrong"))
+		return
+	}
+
+	vars := req.URL.Query()
+	year := time.Now().Year()
+	if str := vars.Get("year"); str != "" {
+		year, err = strconv.Atoi(str)
+		if err != nil || year < 1 || year > 9999 {
+			s.LogError("year format is wrong", "UserReport", err, vars)
+			s.writeError(w, req, NewError(CodeInvalidParameter, "year must be a number between 1 and 9999"))
+			return
+		}
+	}
+
+	report, err := s.userReport(req.Context(), user, year)
+	if err != nil {
+		s.LogError("user report error", "UserReport", err, vars)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+	resp := userReportResponse(*report)
+
+	if !reportWantsHTML(req) {
+		r, err := json.Marshal(resp)
+		if err != nil {
+			s.LogError("JSON marshal error", "UserReport", err, resp)
+			s.writeError(w, req, ErrInternal)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(r)
+		return
+	}
+
+	// рендерим в буфер, чтобы не отдать половину страницы при ошибке шаблона
+	var buf strings.Builder
+	err = reportTemplate.Execute(&buf, reportPage{&resp, reportChartOf(resp.Months)})
+	if err != nil {
+		s.LogError("report template error", "UserReport", err, nil)
+		s.writeError(w, req, ErrInternal)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(buf.String()))
+}
+
+// данные отчета: суммы - по логике SubscriptionTotal за январь-декабрь
+func (s *Server) userReport(ctx context.Context, user uuid.UUID, year int) (*model.UserReport, error) {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(year, time.December, 1, 0, 0, 0, 0, time.UTC)
+	f := model.Filter{UserId: user, Start: &start, End: &end}
+
+	report := &model.UserReport{UserId: user, Year: year}
+	var err error
+	report.Total, err = s.repo.SubscriptionTotal(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	report.Services, err = s.repo.SubscriptionTotalGroup(ctx, f, []string{model.GroupService})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(report.Services, func(i, j int) bool {
+		return report.Services[i].Total > report.Services[j].Total
+	})
+	report.Months, err = s.repo.SubscriptionTimeSeries(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	subs, err := s.listAll(ctx, user, "", &start, &end)
+	if err != nil {
+		return nil, err
+	}
+	report.Started = make([]model.Subscription, 0)
+	report.Ended = make([]model.Subscription, 0)
+	for i, sub := range subs {
+		if report.MostExpensive == nil || sub.Price > report.MostExpensive.Price {
+			report.MostExpensive = &subs[i]
+		}
+		if sub.StartDate.Year() == year {
+			report.Started = append(report.Started, sub)
+		}
+		if sub.EndDate != nil && sub.EndDate.Year() == year {
+			report.Ended = append(report.Ended, sub)
+		}
+	}
+	return report, nil
+}
+
+// HTML по умолчанию, JSON - по format=json или Accept: application/json
+func reportWantsHTML(req *http.Request) bool {
+	switch req.URL.Query().Get("format") {
+	case "json":
+		return false
+	case "html":
+		return true
+	}
+	for _, part := range strings.Split(req.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mt {
+		case "text/html":
+			return true
+		case "application/json":
+			return false
+		}
+	}
+	return true
+}
+
+// столбчатая диаграмма по месяцам
+func reportChartOf(months []TimeSeriesPoint) reportChart {
+	chart := reportChart{Width: chartWidth, Height: chartHeight, LabelY: chartTop + chartPlot + 16}
+	var top uint
+	for _, m := range months {
+		top = max(top, m.Total)
+	}
+	slot := 0
+	if len(months) > 0 {
+		slot = (chartWidth - 2*chartPad) / len(months)
+	}
+	for i, m := range months {
+		h := 0
+		if top > 0 {
+			h = int(uint64(m.Total) * chartPlot / uint64(top))
+		}
+		x := chartPad + i*slot + (slot-chartBar)/2
+		chart.Bars = append(chart.Bars, reportBar{
+			X:      x,
+			Y:      chartTop + chartPlot - h,
+			Width:  chartBar,
+			Height: h,
+			LabelX: x + chartBar/2,
+			ValueY: chartTop + chartPlot - h - 4,
+			Label:  m.Month,
+			Total:  m.Total,
+		})
+	}
+	return chart
+}
@@ -0,0 +1,173 @@
+package emsub
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	config "github.com/glkeru/EM_Subscriptions/internal/config"
+	interfaces "github.com/glkeru/EM_Subscriptions/internal/interfaces"
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	utils "github.com/glkeru/EM_Subscriptions/internal/utils"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// таймаут фоновой проверки бюджетов
+const CheckTimeout = 10 * time.Second
+
+// расчет бюджетов и отправка предупреждений, общие для всех API
+type Checker struct {
+	repo      interfaces.Repository
+	notifier  interfaces.Notifier
+	logger    *zap.Logger
+	threshold uint
+
+	mu sync.Mutex
+	// пользователи с идущей проверкой; true - после нее нужна еще одна
+	pending map[uuid.UUID]bool
+}
+
+func NewChecker(repo interfaces.Repository, notifier interfaces.Notifier, logger *zap.Logger, c *config.Config) *Checker {
+	return &Checker{repo: repo, notifier: notifier, logger: logger, threshold: c.BudgetThreshold, pending: make(map[uuid.UUID]bool)}
+}
+
+// расходы по бюджету за текущий и следующий месяц тем же расчетом, что и total,
+// и превышенные пороги. Только чтение: предупреждения отправляет Check
+func (c *Checker) Evaluate(ctx context.Context, b model.Budget) (*model.BudgetStatus, error) {
+	month := utils.MonthStart(time.Now())
+	next := month.AddDate(0, 1, 0)
+
+	st := &model.BudgetStatus{Budget: b, Month: month, Threshold: c.threshold}
+	if b.Threshold != nil {
+		st.Threshold = *b.Threshold
+	}
+
+	f := model.Filter{UserId: b.UserId}
+	if b.ServiceName != nil {
+		f.ServiceName = *b.ServiceName
+	}
+	if b.Category != nil {
+		f.Category = *b.Category
+	}
+
+	var err error
+	f.Start, f.End = &month, &month
+	st.Current, err = c.repo.SubscriptionTotal(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	f.Start, f.End = &next, &next
+	st.Projected, err = c.repo.SubscriptionTotal(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := []struct {
+		kind  string
+		month time.Time
+		spend uint
+	}{
+		{model.AlertCurrent, month, st.Current},
+		{model.AlertProjected, next, st.Projected},
+	}
+	for _, ch := range checks {
+		if uint64(ch.spend)*100 < uint64(b.Amount)*uint64(st.Threshold) {
+			continue
+		}
+		st.Alerts = append(st.Alerts, model.BudgetAlert{
+			BudgetId:  b.Id,
+			UserId:    b.UserId,
+			Kind:      ch.kind,
+			Month:     ch.month,
+			Amount:    b.Amount,
+			Spend:     ch.spend,
+			Threshold: st.Threshold,
+		})
+	}
+
+	return st, nil
+}
+
+// фоновая проверка бюджетов пользователя после изменения подписок или бюджетов.
+// Запросы во время идущей проверки схлопываются в одну повторную: импорт не запускает проверку на каждую строку
+func (c *Checker) Check(user uuid.UUID) {
+	c.mu.Lock()
+	if _, ok := c.pending[user]; ok {
+		c.pending[user] = true
+		c.mu.Unlock()
+		return
+	}
+	c.pending[user] = false
+	c.mu.Unlock()
+
+	go func() {
+		for {
+			c.check(user)
+
+			c.mu.Lock()
+			again := c.pending[user]
+			if !again {
+				delete(c.pending, user)
+			} else {
+				c.pending[user] = false
+			}
+			c.mu.Unlock()
+			if !again {
+				return
+			}
+		}
+	}()
+}
+
+func (c *Checker) check(user uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), CheckTimeout)
+	defer cancel()
+
+	budgets, err := c.repo.BudgetListAll(ctx, user)
+	if err != nil {
+		c.LogError("DB list budgets", "Check", err, user)
+		return
+	}
+	for _, b := range budgets {
+		st, err := c.Evaluate(ctx, b)
+		if err != nil {
+			c.LogError("budget evaluation error", "Check", err, b.Id)
+			continue
+		}
+		for _, alert := range st.Alerts {
+			err = c.sendAlert(ctx, alert)
+			if err != nil {
+				c.LogError("budget alert notify error", "Check", err, alert)
+			}
+		}
+	}
+}
+
+// отправка предупреждения не чаще раза в месяц на каждый вид;
+// при ошибке отправки отметка снимается, чтобы предупреждение не потерялось
+func (c *Checker) sendAlert(ctx context.Context, alert model.BudgetAlert) error {
+	// отметка до отправки защищает от повторной отправки при параллельных проверках
+	sent, err := c.repo.BudgetMarkAlerted(ctx, alert.BudgetId, alert.Kind, alert.Month)
+	if err != nil || !sent {
+		return err
+	}
+	err = c.notifier.Notify(ctx, alert)
+	if err == nil {
+		return nil
+	}
+	uerr := c.repo.BudgetUnmarkAlerted(ctx, alert.BudgetId, alert.Kind, alert.Month)
+	if uerr != nil {
+		c.LogError("DB unmark budget alert", "sendAlert", uerr, alert)
+	}
+	return err
+}
+
+// логирование ошибок
+func (c *Checker) LogError(msg, service string, err error, data any) {
+	c.logger.Error(msg,
+		zap.String("service", service),
+		zap.Error(err),
+		zap.Any("data", data),
+	)
+}
@@ -0,0 +1,107 @@
+package emsub
+
+import (
+	"context"
+
+	interfaces "github.com/glkeru/EM_Subscriptions/internal/interfaces"
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/google/uuid"
+)
+
+// репозиторий, проверяющий бюджеты пользователя после изменений: проверка не зависит от API
+type Repository struct {
+	interfaces.Repository
+	budgets interfaces.Budgets
+}
+
+func NewRepository(repo interfaces.Repository, budgets interfaces.Budgets) *Repository {
+	return &Repository{repo, budgets}
+}
+
+func (r *Repository) SubscriptionCreate(ctx context.Context, s model.Subscription) (uuid.UUID, error) {
+	id, err := r.Repository.SubscriptionCreate(ctx, s)
+	if err != nil {
+		return id, err
+	}
+	r.budgets.Check(s.UserId)
+	return id, nil
+}
+
+// при смене пользователя проверяются бюджеты обоих
+func (r *Repository) SubscriptionUpdate(ctx context.Context, s model.Subscription) error {
+	old, err := r.Repository.SubscriptionRead(ctx, s.Id)
+	if err != nil {
+		return err
+	}
+	err = r.Repository.SubscriptionUpdate(ctx, s)
+	if err != nil {
+		return err
+	}
+	r.check(old.UserId, s.UserId)
+	return nil
+}
+
+func (r *Repository) SubscriptionPatch(ctx context.Context, id uuid.UUID, p model.SubscriptionPatch) error {
+	return r.SubscriptionPatchWith(ctx, id, func(model.Subscription) (model.SubscriptionPatch, error) {
+		return p, nil
+	})
+}
+
+// пользователь до изменения берется из заблокированной строки, без отдельного чтения
+func (r *Repository) SubscriptionPatchWith(ctx context.Context, id uuid.UUID, fn func(model.Subscription) (model.SubscriptionPatch, error)) error {
+	var old uuid.UUID
+	var patch model.SubscriptionPatch
+	err := r.Repository.SubscriptionPatchWith(ctx, id, func(sub model.Subscription) (model.SubscriptionPatch, error) {
+		old = sub.UserId
+		var err error
+		patch, err = fn(sub)
+		return patch, err
+	})
+	if err != nil || patch.Empty() {
+		return err
+	}
+	user := old
+	if patch.UserId != nil {
+		user = *patch.UserId
+	}
+	r.check(old, user)
+	return nil
+}
+
+func (r *Repository) SubscriptionDelete(ctx context.Context, id uuid.UUID) error {
+	sub, err := r.Repository.SubscriptionRead(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = r.Repository.SubscriptionDelete(ctx, id)
+	if err != nil {
+		return err
+	}
+	r.budgets.Check(sub.UserId)
+	return nil
+}
+
+func (r *Repository) BudgetCreate(ctx context.Context, b model.Budget) (uuid.UUID, error) {
+	id, err := r.Repository.BudgetCreate(ctx, b)
+	if err != nil {
+		return id, err
+	}
+	r.budgets.Check(b.UserId)
+	return id, nil
+}
+
+func (r *Repository) BudgetUpdate(ctx context.Context, b model.Budget) error {
+	err := r.Repository.BudgetUpdate(ctx, b)
+	if err != nil {
+		return err
+	}
+	r.budgets.Check(b.UserId)
+	return nil
+}
+
+func (r *Repository) check(old, user uuid.UUID) {
+	r.budgets.Check(user)
+	if old != user {
+		r.budgets.Check(old)
+	}
+}
@@ -4,6 +4,7 @@ import "github.com/spf13/viper"
 
 type Config struct {
 	Port       string `mapstructure:"EMSUB_HTTP_PORT"`
+	GRPCPort   string `mapstructure:"EMSUB_GRPC_PORT"`
 	DBHost     string `mapstructure:"EMSUB_DB_HOST"`
 	DBPort     string `mapstructure:"EMSUB_DB_PORT"`
 	DBUser     string `mapstructure:"EMSUB_DB_USER"`
@@ -12,6 +13,24 @@ type Config struct {
 	DBSSL      string `mapstructure:"EMSUB_DB_SSL"`
 	Limit      int    `mapstructure:"limit"`
 	LogBody    bool   `mapstructure:"logbody"`
+	Rollup     bool   `mapstructure:"rollup"`
+
+	BudgetThreshold uint   `mapstructure:"budget_threshold"`
+	Notifier        string `mapstructure:"notifier"`
+
+	AnomalyIQR        float64 `mapstructure:"anomaly_iqr"`
+	AnomalyMinSamples int     `mapstructure:"anomaly_min_samples"`
+
+	AnnualDiscount      uint `mapstructure:"annual_discount"`
+	RecommendMinSamples int  `mapstructure:"recommend_min_samples"`
+
+	GraphQLComplexity int `mapstructure:"graphql_complexity"`
+	GraphQLDepth      int `mapstructure:"graphql_depth"`
+
+	EventsBuffer    int `mapstructure:"events_buffer"`
+	EventsHeartbeat int `mapstructure:"events_heartbeat"`
+
+	IdempotencyTTL int `mapstructure:"idempotency_ttl"`
 }
 
 func ConfigLoad() (c *Config, err error) {
@@ -22,8 +41,21 @@ func ConfigLoad() (c *Config, err error) {
 	v.AutomaticEnv()
 
 	v.SetDefault("EMSUB_HTTP_PORT", 8080)
+	v.SetDefault("EMSUB_GRPC_PORT", 9090)
 	v.SetDefault("EMSUB_DB_SLL", "disable")
 	v.SetDefault("EMSUB_QUERY_LIMIT", 10000)
+	v.SetDefault("rollup", true)
+	v.SetDefault("budget_threshold", 80)
+	v.SetDefault("notifier", "log")
+	v.SetDefault("anomaly_iqr", 3)
+	v.SetDefault("anomaly_min_samples", 5)
+	v.SetDefault("annual_discount", 15)
+	v.SetDefault("recommend_min_samples", 5)
+	v.SetDefault("graphql_complexity", 5000)
+	v.SetDefault("graphql_depth", 8)
+	v.SetDefault("events_buffer", 1000)
+	v.SetDefault("events_heartbeat", 15)
+	v.SetDefault("idempotency_ttl", 24)
 
 	_ = v.ReadInConfig()
 
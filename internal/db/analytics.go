@@ -0,0 +1,339 @@
+package emsub
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	utils "github.com/glkeru/EM_Subscriptions/internal/utils"
+	"github.com/google/uuid"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// новые, ушедшие и активные подписки по сервисам и месяцам периода
+func (r *Repository) SubscriptionChurn(ctx context.Context, f model.Filter) ([]model.ChurnPoint, error) {
+	if f.Start == nil || f.End == nil {
+		return nil, errors.New("period is required")
+	}
+
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	args := []any{*f.Start, *f.End, *f.End, *f.Start, *f.Start}
+	sql := `WITH months AS (
+				SELECT generate_series(?::timestamp, ?::timestamp, interval '1 month')::date AS month
+				),
+				subs AS (
+				SELECT s.id, s.service_name, s.start_date, s.end_date
+				FROM public.subscriptions s
+				WHERE s.start_date <= ?::date
+					AND COALESCE(s.end_date, ?::date) >= ?::date`
+	sql, args, err = appendSubFilter(sql, args, "s", f)
+	if err != nil {
+		return nil, err
+	}
+	sql = sql + `
+				),
+				services AS (
+				SELECT DISTINCT service_name FROM subs
+				)
+				SELECT sv.service_name, m.month,
+					COUNT(sb.id) FILTER (WHERE sb.start_date >= m.month) AS new,
+					COUNT(sb.id) FILTER (WHERE sb.end_date < m.month + interval '1 month') AS churned,
+					COUNT(sb.id) AS active
+				FROM months m
+				CROSS JOIN services sv
+				LEFT JOIN subs sb ON sb.service_name = sv.service_name
+					AND sb.start_date < m.month + interval '1 month'
+					AND COALESCE(sb.end_date, m.month) >= m.month
+				GROUP BY sv.service_name, m.month
+				ORDER BY sv.service_name, m.month`
+
+	sql, err = sq.Dollar.ReplacePlaceholders(sql)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make([]model.ChurnPoint, 0)
+	for rows.Next() {
+		p := model.ChurnPoint{}
+		err := rows.Scan(&p.ServiceName, &p.Month, &p.New, &p.Churned, &p.Active)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// фильтры по сервису, пользователю, категории и выражению filter для таблицы с алиасом alias
+func appendSubFilter(sql string, args []any, alias string, f model.Filter) (string, []any, error) {
+	if f.ServiceName != "" {
+		sql = sql + ` AND ` + alias + `.service_name = ?`
+		args = append(args, f.ServiceName)
+	}
+	if f.UserId != uuid.Nil {
+		sql = sql + ` AND ` + alias + `.user_id = ?`
+		args = append(args, f.UserId)
+	}
+	if len(f.UserIds) > 0 {
+		sql = sql + ` AND ` + alias + `.user_id = ANY(?)`
+		args = append(args, f.UserIds)
+	}
+	if f.Category != "" {
+		sql = sql + ` AND ` + alias + `.service_name IN (SELECT service_name FROM service_categories WHERE category = ?)`
+		args = append(args, f.Category)
+	}
+	if f.Expr != nil {
+		where, exprArgs, err := f.Expr.Where(alias)
+		if err != nil {
+			return "", nil, err
+		}
+		sql = sql + ` AND ` + where
+		args = append(args, exprArgs...)
+	}
+	return sql, args, nil
+}
+
+// удержание когорт: подписки, начатые в месяце периода, и сколько из них активны через 1..periods месяцев
+func (r *Repository) SubscriptionRetention(ctx context.Context, f model.Filter, periods int) ([]model.Cohort, error) {
+	if f.Start == nil || f.End == nil {
+		return nil, errors.New("period is required")
+	}
+
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	args := []any{*f.Start, *f.End}
+	sql := `WITH cohorts AS (
+				SELECT date_trunc('month', s.start_date)::date AS cohort, s.end_date
+				FROM public.subscriptions s
+				WHERE s.start_date >= ?::date
+					AND s.start_date < ?::date + interval '1 month'`
+	sql, args, err = appendSubFilter(sql, args, "s", f)
+	if err != nil {
+		return nil, err
+	}
+	sql = sql + `
+				),
+				offsets AS (
+				SELECT generate_series(0, ?::int) AS k
+				)
+				SELECT c.cohort, o.k,
+					COUNT(*) FILTER (WHERE c.end_date IS NULL OR c.end_date >= c.cohort + make_interval(months => o.k))
+				FROM cohorts c
+				CROSS JOIN offsets o
+				WHERE c.cohort + make_interval(months => o.k) <= date_trunc('month', now())
+				GROUP BY c.cohort, o.k
+				ORDER BY c.cohort, o.k`
+	args = append(args, periods)
+
+	sql, err = sq.Dollar.ReplacePlaceholders(sql)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// k = 0 - размер когорты
+	cohorts := make([]model.Cohort, 0)
+	for rows.Next() {
+		var month time.Time
+		var k, count int
+		err := rows.Scan(&month, &k, &count)
+		if err != nil {
+			return nil, err
+		}
+		if k == 0 {
+			cohorts = append(cohorts, model.Cohort{Month: month, Size: count, Retained: make([]int, 0, periods)})
+			continue
+		}
+		if n := len(cohorts); n > 0 && cohorts[n-1].Month.Equal(month) {
+			cohorts[n-1].Retained = append(cohorts[n-1].Retained, count)
+		}
+	}
+	return cohorts, rows.Err()
+}
+
+// MRR по месяцам периода с разбивкой изменения на new, expansion, contraction и churn
+// изменение считается по паре пользователь + сервис: сумма цен активных в месяце подписок
+// против суммы в предыдущем месяце, так учитываются и смены цены, и замена подписки на другую
+func (r *Repository) SubscriptionMRR(ctx context.Context, f model.Filter) ([]model.MRRPoint, error) {
+	if f.Start == nil || f.End == nil {
+		return nil, errors.New("period is required")
+	}
+
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	// предыдущий месяц нужен для изменения в первом месяце периода
+	args := []any{*f.Start, *f.End}
+	sql := `WITH months AS (
+				SELECT generate_series(?::timestamp - interval '1 month', ?::timestamp, interval '1 month')::date AS month
+				),
+				mrr AS (
+				SELECT m.month, s.user_id, s.service_name, SUM(s.price) AS amount
+				FROM months m
+				JOIN public.subscriptions s ON s.start_date <= m.month
+					AND COALESCE(s.end_date, m.month) >= m.month`
+	sql, args, err = appendSubFilter(sql, args, "s", f)
+	if err != nil {
+		return nil, err
+	}
+	sql = sql + `
+				GROUP BY m.month, s.user_id, s.service_name
+				),
+				shifted AS (
+				SELECT month, user_id, service_name, amount AS cur, 0 AS prev FROM mrr
+				UNION ALL
+				SELECT (month + interval '1 month')::date, user_id, service_name, 0, amount FROM mrr
+				),
+				moves AS (
+				SELECT month, SUM(cur) AS cur, SUM(prev) AS prev
+				FROM shifted
+				GROUP BY month, user_id, service_name
+				)
+				SELECT m.month,
+					COALESCE(SUM(mv.cur), 0)::bigint,
+					COALESCE(SUM(mv.cur) FILTER (WHERE mv.prev = 0), 0)::bigint,
+					COALESCE(SUM(mv.cur - mv.prev) FILTER (WHERE mv.prev > 0 AND mv.cur > mv.prev), 0)::bigint,
+					COALESCE(SUM(mv.prev - mv.cur) FILTER (WHERE mv.cur > 0 AND mv.cur < mv.prev), 0)::bigint,
+					COALESCE(SUM(mv.prev) FILTER (WHERE mv.cur = 0), 0)::bigint
+				FROM months m
+				LEFT JOIN moves mv ON mv.month = m.month
+				WHERE m.month >= ?::date
+				GROUP BY m.month
+				ORDER BY m.month`
+	args = append(args, *f.Start)
+
+	sql, err = sq.Dollar.ReplacePlaceholders(sql)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make([]model.MRRPoint, 0)
+	for rows.Next() {
+		p := model.MRRPoint{}
+		err := rows.Scan(&p.Month, &p.MRR, &p.New, &p.Expansion, &p.Contraction, &p.Churned)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// статистика цен подписок сервиса за период, период - как в SubscriptionList
+func (r *Repository) SubscriptionPriceStats(ctx context.Context, f model.Filter) (*model.PriceStats, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	// без периода - текущие цены: подписки, действующие в текущем месяце
+	if f.Start == nil && f.End == nil {
+		month := utils.MonthStart(time.Now())
+		f.Start, f.End = &month, &month
+	}
+
+	sql, args, err := sq.Select(
+		"COUNT(DISTINCT user_id)",
+		"COUNT(*)",
+		"COALESCE(MIN(price), 0)",
+		"COALESCE(MAX(price), 0)",
+		"COALESCE(AVG(price), 0)::float8",
+		"COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY price), 0)::float8",
+		"COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY price), 0)::float8").
+		From("subscriptions").
+		Where(sq.Eq{"service_name": f.ServiceName}).
+		Where(periodWhere(f.Start, f.End)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	st := &model.PriceStats{}
+	err = conn.QueryRow(ctx, sql, args...).Scan(&st.Subscribers, &st.Count, &st.Min, &st.Max, &st.Mean, &st.Median, &st.P90)
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// помесячная статистика цен активных подписок сервиса
+func (r *Repository) SubscriptionPriceHistory(ctx context.Context, f model.Filter) ([]model.PriceStats, error) {
+	if f.Start == nil || f.End == nil {
+		return nil, errors.New("period is required")
+	}
+
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	sql, err := sq.Dollar.ReplacePlaceholders(`WITH months AS (
+				SELECT generate_series(?::timestamp, ?::timestamp, interval '1 month')::date AS month
+				)
+				SELECT m.month,
+					COUNT(DISTINCT s.user_id),
+					COUNT(s.id),
+					COALESCE(MIN(s.price), 0),
+					COALESCE(MAX(s.price), 0),
+					COALESCE(AVG(s.price), 0)::float8,
+					COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY s.price), 0)::float8,
+					COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY s.price), 0)::float8
+				FROM months m
+				LEFT JOIN public.subscriptions s ON s.service_name = ?
+					AND s.start_date <= m.month
+					AND COALESCE(s.end_date, m.month) >= m.month
+				GROUP BY m.month
+				ORDER BY m.month`)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, sql, *f.Start, *f.End, f.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]model.PriceStats, 0)
+	for rows.Next() {
+		st := model.PriceStats{}
+		var month time.Time
+		err := rows.Scan(&month, &st.Subscribers, &st.Count, &st.Min, &st.Max, &st.Mean, &st.Median, &st.P90)
+		if err != nil {
+			return nil, err
+		}
+		st.Month = &month
+		history = append(history, st)
+	}
+	return history, rows.Err()
+}
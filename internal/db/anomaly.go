@@ -0,0 +1,128 @@
+package emsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// границы считаются по квартилям: [Q1 - k*IQR, Q3 + k*IQR],
+// размах не меньше 10% медианы, иначе при одинаковых ценах любое отличие - аномалия
+const priceBoundsCTE = `bounds AS (
+				SELECT service_name,
+					COUNT(*) AS cnt,
+					percentile_cont(0.5) WITHIN GROUP (ORDER BY price) AS median,
+					percentile_cont(0.25) WITHIN GROUP (ORDER BY price) AS q1,
+					percentile_cont(0.75) WITHIN GROUP (ORDER BY price) AS q3
+				FROM public.subscriptions
+				%s
+				GROUP BY service_name
+				),
+				limits AS (
+				SELECT service_name, cnt, median,
+					q1 - ?::float8 * GREATEST(q3 - q1, median / 10) AS low,
+					q3 + ?::float8 * GREATEST(q3 - q1, median / 10) AS high
+				FROM bounds
+				)`
+
+// границы обычной цены сервиса по его подпискам, кроме exclude: проверяемая подписка не входит в свою базу
+func (r *Repository) SubscriptionPriceBounds(ctx context.Context, service_name string, exclude uuid.UUID, k float64) (*model.PriceBounds, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	sql, err := sq.Dollar.ReplacePlaceholders(`WITH ` + boundsCTE(`WHERE service_name = ? AND id <> ?`) + `
+				SELECT service_name, cnt, median::float8, low::float8, high::float8
+				FROM limits`)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &model.PriceBounds{}
+	err = conn.QueryRow(ctx, sql, service_name, exclude, k, k).Scan(&b.ServiceName, &b.Count, &b.Median, &b.Low, &b.High)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrNotFound
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// подписки с ценой вне границ своего сервиса, сначала наибольшие отклонения
+func (r *Repository) SubscriptionAnomalies(ctx context.Context, f model.Filter, k float64, minSamples int, limit int, offset int) ([]model.PriceAnomaly, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var args []any
+	where := ``
+	if f.ServiceName != "" {
+		where = `WHERE service_name = ?`
+		args = append(args, f.ServiceName)
+	}
+	args = append(args, k, k, minSamples)
+
+	sql := `WITH ` + boundsCTE(where) + `
+				SELECT s.id, s.service_name, s.user_id, s.price, s.start_date, s.end_date,
+					l.cnt, l.median::float8, l.low::float8, l.high::float8
+				FROM public.subscriptions s
+				JOIN limits l ON l.service_name = s.service_name
+				WHERE l.cnt >= ?
+					AND (s.price < l.low OR s.price > l.high)`
+	sql, args, err = appendSubFilter(sql, args, "s", f)
+	if err != nil {
+		return nil, err
+	}
+	if f.End != nil {
+		sql = sql + ` AND s.start_date <= ?`
+		args = append(args, *f.End)
+	}
+	if f.Start != nil {
+		sql = sql + ` AND (s.end_date >= ? OR s.end_date IS NULL)`
+		args = append(args, *f.Start)
+	}
+	if limit == 0 {
+		limit = r.config.Limit
+	}
+	sql = sql + ` ORDER BY ABS(s.price - l.median) / GREATEST(l.median, 1) DESC, s.id
+				LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	sql, err = sq.Dollar.ReplacePlaceholders(sql)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anomalies := make([]model.PriceAnomaly, 0)
+	for rows.Next() {
+		a := model.PriceAnomaly{}
+		err := rows.Scan(&a.Id, &a.ServiceName, &a.UserId, &a.Price, &a.StartDate, &a.EndDate,
+			&a.Bounds.Count, &a.Bounds.Median, &a.Bounds.Low, &a.Bounds.High)
+		if err != nil {
+			return nil, err
+		}
+		a.Bounds.ServiceName = a.ServiceName
+		anomalies = append(anomalies, a)
+	}
+	return anomalies, rows.Err()
+}
+
+func boundsCTE(where string) string {
+	return fmt.Sprintf(priceBoundsCTE, where)
+}
@@ -0,0 +1,236 @@
+package emsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// создание бюджета
+func (r *Repository) BudgetCreate(ctx context.Context, b model.Budget) (uuid.UUID, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer conn.Release()
+
+	b.Id = uuid.New()
+
+	sql, args, err := sq.Insert("budgets").
+		Columns("id", "user_id", "amount", "service_name", "category", "threshold").
+		Values(b.Id, b.UserId, b.Amount, b.ServiceName, b.Category, b.Threshold).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = conn.Exec(ctx, sql, args...)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return b.Id, nil
+}
+
+// чтение бюджета
+func (r *Repository) BudgetRead(ctx context.Context, id uuid.UUID) (*model.Budget, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	b := &model.Budget{}
+	row := conn.QueryRow(ctx, "SELECT id, user_id, amount, service_name, category, threshold FROM budgets WHERE id = $1", id)
+	err = row.Scan(&b.Id, &b.UserId, &b.Amount, &b.ServiceName, &b.Category, &b.Threshold)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("budget %w", model.ErrNotFound)
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// обновление бюджета, отметки о предупреждениях сбрасываются
+func (r *Repository) BudgetUpdate(ctx context.Context, b model.Budget) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	sql, args, err := sq.Update("budgets").
+		Set("user_id", b.UserId).
+		Set("amount", b.Amount).
+		Set("service_name", b.ServiceName).
+		Set("category", b.Category).
+		Set("threshold", b.Threshold).
+		Set("alert_current_month", nil).
+		Set("alert_projected_month", nil).
+		Where(sq.Eq{"id": b.Id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	cmdTag, err := conn.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return fmt.Errorf("budget %w", model.ErrNotFound)
+	}
+	return nil
+}
+
+// удаление бюджета
+func (r *Repository) BudgetDelete(ctx context.Context, id uuid.UUID) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	cmdTag, err := conn.Exec(ctx, "DELETE FROM budgets WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return fmt.Errorf("budget %w", model.ErrNotFound)
+	}
+	return nil
+}
+
+// список бюджетов, uuid.Nil - всех пользователей
+func (r *Repository) BudgetList(ctx context.Context, user uuid.UUID, limit int, offset int) ([]model.Budget, error) {
+	if limit == 0 {
+		limit = r.config.Limit
+	}
+	sqlist := budgetSelect(user).
+		Offset(uint64(offset)).
+		Limit(uint64(limit))
+	return r.budgetQuery(ctx, sqlist)
+}
+
+// все бюджеты пользователя без лимита - для проверки после изменений
+func (r *Repository) BudgetListAll(ctx context.Context, user uuid.UUID) ([]model.Budget, error) {
+	return r.budgetQuery(ctx, budgetSelect(user))
+}
+
+func budgetSelect(user uuid.UUID) sq.SelectBuilder {
+	sqlist := sq.Select("id", "user_id", "amount", "service_name", "category", "threshold").
+		From("budgets").
+		PlaceholderFormat(sq.Dollar).
+		OrderBy("user_id ASC", "id ASC")
+	if user != uuid.Nil {
+		sqlist = sqlist.Where(sq.Eq{"user_id": user})
+	}
+	return sqlist
+}
+
+func (r *Repository) budgetQuery(ctx context.Context, sqlist sq.SelectBuilder) ([]model.Budget, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	sql, args, err := sqlist.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := make([]model.Budget, 0)
+	for rows.Next() {
+		b := model.Budget{}
+		err := rows.Scan(&b.Id, &b.UserId, &b.Amount, &b.ServiceName, &b.Category, &b.Threshold)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, b)
+	}
+	return budgets, rows.Err()
+}
+
+// отметка об отправленном предупреждении, false - за этот месяц уже отправляли
+func (r *Repository) BudgetMarkAlerted(ctx context.Context, id uuid.UUID, kind string, month time.Time) (bool, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+
+	col, err := alertColumn(kind)
+	if err != nil {
+		return false, err
+	}
+
+	// условие в UPDATE защищает от повторной отправки при параллельных проверках
+	sql, args, err := sq.Update("budgets").
+		Set(col, month).
+		Where(sq.Eq{"id": id}).
+		Where(sq.Expr(col+" IS DISTINCT FROM ?::date", month)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	cmdTag, err := conn.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, err
+	}
+	return cmdTag.RowsAffected() == 1, nil
+}
+
+// снятие отметки, если предупреждение не удалось отправить: следующая проверка отправит снова
+func (r *Repository) BudgetUnmarkAlerted(ctx context.Context, id uuid.UUID, kind string, month time.Time) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	col, err := alertColumn(kind)
+	if err != nil {
+		return err
+	}
+	sql, args, err := sq.Update("budgets").
+		Set(col, nil).
+		Where(sq.Eq{"id": id}).
+		Where(sq.Expr(col+" = ?::date", month)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(ctx, sql, args...)
+	return err
+}
+
+func alertColumn(kind string) (string, error) {
+	switch kind {
+	case model.AlertCurrent:
+		return "alert_current_month", nil
+	case model.AlertProjected:
+		return "alert_projected_month", nil
+	default:
+		return "", fmt.Errorf("unknown alert kind %q", kind)
+	}
+}
@@ -0,0 +1,61 @@
+package emsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// установка (замена) хеша токена календаря пользователя
+func (r *Repository) CalendarTokenSet(ctx context.Context, user uuid.UUID, hash string) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `INSERT INTO calendar_tokens (user_id, token_hash) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = now()`, user, hash)
+	return err
+}
+
+// хеш токена календаря пользователя
+func (r *Repository) CalendarTokenRead(ctx context.Context, user uuid.UUID) (string, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Release()
+
+	var hash string
+	err = conn.QueryRow(ctx, "SELECT token_hash FROM calendar_tokens WHERE user_id = $1", user).Scan(&hash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("calendar token %w", model.ErrNotFound)
+		}
+		return "", err
+	}
+	return hash, nil
+}
+
+// отзыв токена календаря
+func (r *Repository) CalendarTokenDelete(ctx context.Context, user uuid.UUID) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	cmdTag, err := conn.Exec(ctx, "DELETE FROM calendar_tokens WHERE user_id = $1", user)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return fmt.Errorf("calendar token %w", model.ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package emsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// установка категории сервиса
+func (r *Repository) CategorySet(ctx context.Context, c model.ServiceCategory) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `INSERT INTO service_categories (service_name, category) VALUES ($1, $2)
+		ON CONFLICT (service_name) DO UPDATE SET category = EXCLUDED.category`, c.ServiceName, c.Category)
+	return err
+}
+
+// категория сервиса
+func (r *Repository) CategoryRead(ctx context.Context, service_name string) (*model.ServiceCategory, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	c := &model.ServiceCategory{}
+	row := conn.QueryRow(ctx, "SELECT service_name, category FROM service_categories WHERE service_name = $1", service_name)
+	err = row.Scan(&c.ServiceName, &c.Category)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("category %w", model.ErrNotFound)
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// категории нескольких сервисов одним запросом, сервисы без категории пропускаются
+func (r *Repository) CategoryReadMany(ctx context.Context, service_names []string) ([]model.ServiceCategory, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, "SELECT service_name, category FROM service_categories WHERE service_name = ANY($1)", service_names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cats := make([]model.ServiceCategory, 0, len(service_names))
+	for rows.Next() {
+		c := model.ServiceCategory{}
+		err := rows.Scan(&c.ServiceName, &c.Category)
+		if err != nil {
+			return nil, err
+		}
+		cats = append(cats, c)
+	}
+	return cats, rows.Err()
+}
+
+// удаление категории сервиса
+func (r *Repository) CategoryDelete(ctx context.Context, service_name string) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	cmdTag, err := conn.Exec(ctx, "DELETE FROM service_categories WHERE service_name = $1", service_name)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return fmt.Errorf("category %w", model.ErrNotFound)
+	}
+	return nil
+}
+
+// все категории сервисов
+func (r *Repository) CategoryList(ctx context.Context) ([]model.ServiceCategory, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, "SELECT service_name, category FROM service_categories ORDER BY category, service_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cats := make([]model.ServiceCategory, 0)
+	for rows.Next() {
+		c := model.ServiceCategory{}
+		err := rows.Scan(&c.ServiceName, &c.Category)
+		if err != nil {
+			return nil, err
+		}
+		cats = append(cats, c)
+	}
+	return cats, rows.Err()
+}
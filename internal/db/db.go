@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -16,6 +17,12 @@ import (
 	sq "github.com/Masterminds/squirrel"
 )
 
+// соединение пула или транзакция
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type Repository struct {
 	pool   *pgxpool.Pool
 	config *config.Config
@@ -33,11 +40,11 @@ func NewRepository(c *config.Config) (*Repository, error) {
 
 // создание подписки
 func (r *Repository) SubscriptionCreate(ctx context.Context, s model.Subscription) (uuid.UUID, error) {
-	conn, err := r.pool.Acquire(ctx)
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
 		return uuid.Nil, err
 	}
-	defer conn.Release()
+	defer tx.Rollback(ctx)
 
 	s.Id = uuid.New()
 
@@ -50,12 +57,18 @@ func (r *Repository) SubscriptionCreate(ctx context.Context, s model.Subscriptio
 		return uuid.Nil, err
 	}
 
-	_, err = conn.Exec(ctx, sql, arg...)
+	_, err = tx.Exec(ctx, sql, arg...)
 	if err != nil {
 		return uuid.Nil, err
 	}
 
-	return s.Id, nil
+	// помесячный агрегат
+	err = rollupApply(ctx, tx, s, 1)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return s.Id, tx.Commit(ctx)
 }
 
 // чтение подписки
@@ -77,13 +90,33 @@ func (r *Repository) SubscriptionRead(ctx context.Context, id uuid.UUID) (*model
 	return sub, nil
 }
 
+// есть ли подписка с теми же полями (кроме id)
+func (r *Repository) SubscriptionExists(ctx context.Context, s model.Subscription) (bool, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+
+	var exists bool
+	err = conn.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM subscriptions
+		WHERE user_id = $1 AND service_name = $2 AND price = $3 AND start_date = $4 AND end_date IS NOT DISTINCT FROM $5)`,
+		s.UserId, s.ServiceName, s.Price, s.StartDate, s.EndDate).Scan(&exists)
+	return exists, err
+}
+
 // обновление подписки (PUT)
 func (r *Repository) SubscriptionUpdate(ctx context.Context, s model.Subscription) error {
-	conn, err := r.pool.Acquire(ctx)
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	old, err := subscriptionForUpdate(ctx, tx, s.Id)
 	if err != nil {
 		return err
 	}
-	defer conn.Release()
 
 	sql, args, err := sq.Update("subscriptions").
 		Set("service_name", s.ServiceName).
@@ -98,100 +131,171 @@ func (r *Repository) SubscriptionUpdate(ctx context.Context, s model.Subscriptio
 		return err
 	}
 
-	cmdTag, err := conn.Exec(ctx, sql, args...)
+	_, err = tx.Exec(ctx, sql, args...)
 	if err != nil {
 		return err
 	}
-	if cmdTag.RowsAffected() == 0 {
-		return fmt.Errorf("subscription %w", model.ErrNotFound)
+
+	// помесячный агрегат: убираем старую версию, добавляем новую
+	err = rollupApply(ctx, tx, *old, -1)
+	if err != nil {
+		return err
+	}
+	err = rollupApply(ctx, tx, s, 1)
+	if err != nil {
+		return err
 	}
-	return nil
+
+	return tx.Commit(ctx)
 }
 
 // обновление подписки (PATCH)
-func (r *Repository) SubscriptionPatch(ctx context.Context, id uuid.UUID, fields map[string]any) error {
-	conn, err := r.pool.Acquire(ctx)
+func (r *Repository) SubscriptionPatch(ctx context.Context, id uuid.UUID, p model.SubscriptionPatch) error {
+	return r.SubscriptionPatchWith(ctx, id, func(model.Subscription) (model.SubscriptionPatch, error) {
+		return p, nil
+	})
+}
+
+// обновление подписки по ее текущему состоянию (JSON Patch): чтение, fn и запись
+// в одной транзакции под блокировкой строки. Ошибка fn возвращается как есть
+func (r *Repository) SubscriptionPatchWith(ctx context.Context, id uuid.UUID, fn func(model.Subscription) (model.SubscriptionPatch, error)) error {
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	defer conn.Release()
+	defer tx.Rollback(ctx)
+
+	old, err := subscriptionForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	p, err := fn(*old)
+	if err != nil {
+		return err
+	}
+	if p.Empty() {
+		return tx.Commit(ctx)
+	}
 
-	// собрать массивы столбцов и значений
-	len := len(fields)
-	cols := make([]string, 0, len)
-	args := make([]any, 0, len)
-	index := 1
-	for k, v := range fields {
-		cols = append(cols, fmt.Sprintf("%s=$%d", k, index))
-		args = append(args, v)
-		index++
+	// обновляем только переданные поля
+	upd := sq.Update("subscriptions").
+		Where(sq.Eq{"id": id}).
+		Suffix("RETURNING id, service_name, user_id, price, start_date, end_date").
+		PlaceholderFormat(sq.Dollar)
+	if p.ServiceName != nil {
+		upd = upd.Set("service_name", *p.ServiceName)
+	}
+	if p.UserId != nil {
+		upd = upd.Set("user_id", *p.UserId)
+	}
+	if p.Price != nil {
+		upd = upd.Set("price", *p.Price)
+	}
+	if p.StartDate != nil {
+		upd = upd.Set("start_date", *p.StartDate)
+	}
+	if p.ClearEnd {
+		upd = upd.Set("end_date", nil)
+	} else if p.EndDate != nil {
+		upd = upd.Set("end_date", *p.EndDate)
 	}
-	args = append(args, id)
-	query := fmt.Sprintf("UPDATE subscriptions SET %s WHERE id=$%d", strings.Join(cols, ","), index)
 
-	cmdTag, err := conn.Exec(ctx, query, args...)
+	sql, args, err := upd.ToSql()
 	if err != nil {
 		return err
 	}
-	if cmdTag.RowsAffected() == 0 {
-		return fmt.Errorf("subscription %w", model.ErrNotFound)
+
+	sub := model.Subscription{}
+	err = tx.QueryRow(ctx, sql, args...).Scan(&sub.Id, &sub.ServiceName, &sub.UserId, &sub.Price, &sub.StartDate, &sub.EndDate)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	// помесячный агрегат: убираем старую версию, добавляем новую
+	err = rollupApply(ctx, tx, *old, -1)
+	if err != nil {
+		return err
+	}
+	err = rollupApply(ctx, tx, sub, 1)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
 // удаление подписки
 func (r *Repository) SubscriptionDelete(ctx context.Context, id uuid.UUID) error {
-	conn, err := r.pool.Acquire(ctx)
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	defer conn.Release()
+	defer tx.Rollback(ctx)
 
-	cmdTag, err := conn.Exec(ctx, "DELETE FROM subscriptions WHERE id = $1", id)
+	sub := model.Subscription{}
+	row := tx.QueryRow(ctx, "DELETE FROM subscriptions WHERE id = $1 RETURNING id, service_name, user_id, price, start_date, end_date", id)
+	err = row.Scan(&sub.Id, &sub.ServiceName, &sub.UserId, &sub.Price, &sub.StartDate, &sub.EndDate)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("subscription %w", model.ErrNotFound)
+		}
 		return err
 	}
-	if cmdTag.RowsAffected() == 0 {
-		return fmt.Errorf("subscription %w", model.ErrNotFound)
+
+	// помесячный агрегат
+	err = rollupApply(ctx, tx, sub, -1)
+	if err != nil {
+		return err
 	}
-	return nil
+
+	return tx.Commit(ctx)
+}
+
+// текущая версия подписки с блокировкой строки до конца транзакции
+func subscriptionForUpdate(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*model.Subscription, error) {
+	sub := &model.Subscription{}
+	row := tx.QueryRow(ctx, "SELECT id, service_name, user_id, price, start_date, end_date FROM subscriptions WHERE id = $1 FOR UPDATE", id)
+	err := row.Scan(&sub.Id, &sub.ServiceName, &sub.UserId, &sub.Price, &sub.StartDate, &sub.EndDate)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("subscription %w", model.ErrNotFound)
+		}
+		return nil, err
+	}
+	return sub, nil
 }
 
 // список подписок
-func (r *Repository) SubscriptionList(ctx context.Context, user uuid.UUID, service_name string, start *time.Time, end *time.Time, limit int, offset int) ([]model.Subscription, error) {
+func (r *Repository) SubscriptionList(ctx context.Context, f model.Filter, limit int, offset int, opts model.ListOptions) ([]model.Subscription, error) {
+	cols := ListColumns
+	if len(opts.Fields) > 0 {
+		cols = opts.Fields
+	}
+	for _, c := range cols {
+		if !slices.Contains(ListColumns, c) {
+			return nil, fmt.Errorf("unknown field %q", c)
+		}
+	}
+	order, err := listOrder(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+
 	conn, err := r.pool.Acquire(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Release()
 
-	sqlist := sq.Select("id", "service_name", "user_id", "price", "start_date", "end_date").
+	where, err := listWhere(f)
+	if err != nil {
+		return nil, err
+	}
+	sqlist := sq.Select(cols...).
 		From("subscriptions").
 		PlaceholderFormat(sq.Dollar).
-		OrderBy("service_name ASC")
-
-	// фильтр: пользователь
-	if user != uuid.Nil {
-		sqlist = sqlist.Where(sq.Eq{"user_id": user})
-	}
-	// фильтр: подписка
-	if service_name != "" {
-		sqlist = sqlist.Where(sq.Eq{"service_name": service_name})
-	}
-	// фильтр: период
-	if start != nil && end != nil {
-		sqlist = sqlist.Where(sq.LtOrEq{"start_date": end}).
-			Where(sq.Or{
-				sq.GtOrEq{"end_date": start},
-				sq.Eq{"end_date": nil}})
-	} else if start != nil {
-		sqlist = sqlist.Where(sq.Or{
-			sq.GtOrEq{"end_date": start},
-			sq.Eq{"end_date": nil}})
-	} else if end != nil {
-		sqlist = sqlist.Where(sq.LtOrEq{"start_date": end})
-	}
+		Where(where).
+		OrderBy(order...)
 
 	if limit != 0 {
 		sqlist = sqlist.Limit(uint64(limit))
@@ -213,6 +317,62 @@ func (r *Repository) SubscriptionList(ctx context.Context, user uuid.UUID, servi
 
 	subs := make([]model.Subscription, 0, limit)
 
+	dest := make([]any, len(cols))
+	for rows.Next() {
+		sub := model.Subscription{}
+		for i, c := range cols {
+			dest[i] = subscriptionColumn(&sub, c)
+		}
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// страницы списка по каждому пользователю из f.UserIds одним запросом, порядок - как в списке по умолчанию
+func (r *Repository) SubscriptionListPerUser(ctx context.Context, f model.Filter, limit int, offset int) ([]model.Subscription, error) {
+	if limit == 0 {
+		limit = r.config.Limit
+	}
+	order, err := listOrder(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	where, err := listWhere(f)
+	if err != nil {
+		return nil, err
+	}
+	numbered := sq.Select(ListColumns...).
+		Column("ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY " + strings.Join(order, ", ") + ") AS rn").
+		From("subscriptions").
+		Where(where)
+	sql, args, err := sq.Select(ListColumns...).
+		FromSelect(numbered, "n").
+		Where("rn > ? AND rn <= ?", offset, offset+limit).
+		OrderBy(append([]string{"user_id"}, order...)...).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := make([]model.Subscription, 0)
 	for rows.Next() {
 		sub := model.Subscription{}
 		err := rows.Scan(&sub.Id, &sub.ServiceName, &sub.UserId, &sub.Price, &sub.StartDate, &sub.EndDate)
@@ -224,43 +384,344 @@ func (r *Repository) SubscriptionList(ctx context.Context, user uuid.UUID, servi
 	return subs, rows.Err()
 }
 
+// условия списка: пользователь, подписка, период и выражение filter
+func listWhere(f model.Filter) (sq.And, error) {
+	cond := sq.And{}
+	if f.UserId != uuid.Nil {
+		cond = append(cond, sq.Eq{"user_id": f.UserId})
+	}
+	if len(f.UserIds) > 0 {
+		cond = append(cond, sq.Eq{"user_id": f.UserIds})
+	}
+	if f.ServiceName != "" {
+		cond = append(cond, sq.Eq{"service_name": f.ServiceName})
+	}
+	cond = append(cond, periodWhere(f.Start, f.End))
+	if f.Expr != nil {
+		where, args, err := f.Expr.Where("")
+		if err != nil {
+			return nil, err
+		}
+		cond = append(cond, sq.Expr(where, args...))
+	}
+	return cond, nil
+}
+
+// колонки списка, доступные для выборки и сортировки
+var ListColumns = []string{"id", "service_name", "user_id", "price", "start_date", "end_date"}
+
+// поле подписки для колонки
+func subscriptionColumn(sub *model.Subscription, col string) any {
+	switch col {
+	case "id":
+		return &sub.Id
+	case "service_name":
+		return &sub.ServiceName
+	case "user_id":
+		return &sub.UserId
+	case "price":
+		return &sub.Price
+	case "start_date":
+		return &sub.StartDate
+	default:
+		return &sub.EndDate
+	}
+}
+
+// ORDER BY списка: по умолчанию по сервису, id в конце всегда - для стабильных страниц.
+// Бессрочные подписки (end_date NULL) при сортировке по возрастанию идут последними.
+func listOrder(keys []model.SortKey) ([]string, error) {
+	if len(keys) == 0 {
+		return []string{"service_name ASC", "id ASC"}, nil
+	}
+	order := make([]string, 0, len(keys)+1)
+	byId := false
+	for _, k := range keys {
+		if !slices.Contains(ListColumns, k.Field) {
+			return nil, fmt.Errorf("unknown sort field %q", k.Field)
+		}
+		dir := " ASC"
+		if k.Desc {
+			dir = " DESC"
+		}
+		order = append(order, k.Field+dir)
+		byId = byId || k.Field == "id"
+	}
+	if !byId {
+		order = append(order, "id ASC")
+	}
+	return order, nil
+}
+
+// условие пересечения подписки с периодом, границы необязательны
+func periodWhere(start *time.Time, end *time.Time) sq.And {
+	cond := sq.And{}
+	if end != nil {
+		cond = append(cond, sq.LtOrEq{"start_date": end})
+	}
+	if start != nil {
+		cond = append(cond, sq.Or{
+			sq.GtOrEq{"end_date": start},
+			sq.Eq{"end_date": nil}})
+	}
+	return cond
+}
+
 // стоимость подписок
-func (r *Repository) SubscriptionTotal(ctx context.Context, user uuid.UUID, service_name string, start *time.Time, end *time.Time) (total uint, err error) {
+func (r *Repository) SubscriptionTotal(ctx context.Context, f model.Filter) (total uint, err error) {
 	conn, err := r.pool.Acquire(ctx)
 	if err != nil {
 		return 0, err
 	}
 	defer conn.Release()
 
+	if r.rollupAllowed(f) {
+		return r.rollupTotal(ctx, conn, f)
+	}
+
+	sql, args, err := totalCTE(f)
+	if err != nil {
+		return 0, err
+	}
+
+	// умножаем кол-во месяцев на стоимость
+	sql = sql + `
+				SELECT COALESCE(SUM(price * months_in_period), 0) AS total_revenue
+				FROM per_sub;
+				`
+	sql, err = sq.Dollar.ReplacePlaceholders(sql)
+	if err != nil {
+		return 0, err
+	}
+	row := conn.QueryRow(ctx, sql, args...)
+	err = row.Scan(&total)
+	if err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// построчная расшифровка суммы и группы по тем же per_sub, без агрегата monthly_rollup:
+// строки и группы читаются в одном снимке и сходятся с итогом
+func (r *Repository) SubscriptionTotalExplain(ctx context.Context, f model.Filter, groupBy []string) ([]model.TotalLine, []model.TotalGroup, error) {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	lines, err := totalLines(ctx, tx, f)
+	if err != nil {
+		return nil, nil, err
+	}
+	var groups []model.TotalGroup
+	if len(groupBy) > 0 {
+		groups, err = totalGroups(ctx, tx, f, groupBy)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return lines, groups, tx.Commit(ctx)
+}
+
+func totalLines(ctx context.Context, q querier, f model.Filter) ([]model.TotalLine, error) {
+	sql, args, err := totalCTE(f)
+	if err != nil {
+		return nil, err
+	}
+	sql = sql + `
+				SELECT id, service_name, user_id, price, overlap_start, overlap_end,
+					months_in_period, price * months_in_period
+				FROM per_sub
+				ORDER BY service_name, user_id, overlap_start, id`
+	sql, err = sq.Dollar.ReplacePlaceholders(sql)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]model.TotalLine, 0)
+	for rows.Next() {
+		l := model.TotalLine{}
+		err := rows.Scan(&l.Id, &l.ServiceName, &l.UserId, &l.Price, &l.OverlapStart, &l.OverlapEnd, &l.Months, &l.Subtotal)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
+
+// стоимость подписок с разбивкой по сервису, пользователю и/или месяцу
+func (r *Repository) SubscriptionTotalGroup(ctx context.Context, f model.Filter, groupBy []string) ([]model.TotalGroup, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	if r.rollupAllowed(f) {
+		return r.rollupTotalGroup(ctx, conn, f, groupBy)
+	}
+	return totalGroups(ctx, conn, f, groupBy)
+}
+
+// разбивка суммы по per_sub
+func totalGroups(ctx context.Context, q querier, f model.Filter, groupBy []string) ([]model.TotalGroup, error) {
+	sql, args, err := totalCTE(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// поля группировки, не участвующие в ней - NULL
+	service, user, month := "NULL::text", "NULL::uuid", "NULL::date"
+	cols := make([]string, 0, len(groupBy))
+	for _, g := range groupBy {
+		switch g {
+		case model.GroupService:
+			service = "service_name"
+		case model.GroupUser:
+			user = "user_id"
+		case model.GroupMonth:
+			month = "month"
+		default:
+			return nil, fmt.Errorf("unknown group %q", g)
+		}
+		cols = append(cols, g)
+	}
+	if len(cols) == 0 {
+		return nil, errors.New("group is required")
+	}
+
+	if month != "NULL::date" {
+		// разворачиваем подписки по месяцам пересечения с периодом
+		sql = fmt.Sprintf(sql+perMonthCTE+`
+				SELECT %s, %s, %s, COALESCE(SUM(price), 0), COUNT(DISTINCT id)
+				FROM per_month`, service, user, month)
+	} else {
+		sql = fmt.Sprintf(sql+`
+				SELECT %s, %s, %s, COALESCE(SUM(price * months_in_period), 0), COUNT(*)
+				FROM per_sub`, service, user, month)
+	}
+	sql = sql + " GROUP BY " + strings.Join(cols, ", ") + " ORDER BY " + strings.Join(cols, ", ")
+
+	sql, err = sq.Dollar.ReplacePlaceholders(sql)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make([]model.TotalGroup, 0)
+	for rows.Next() {
+		g := model.TotalGroup{}
+		err := rows.Scan(&g.ServiceName, &g.UserId, &g.Month, &g.Total, &g.Count)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// помесячная стоимость подписок, месяцы без подписок - с нулевой суммой
+func (r *Repository) SubscriptionTimeSeries(ctx context.Context, f model.Filter) ([]model.MonthTotal, error) {
+	if f.Start == nil || f.End == nil {
+		return nil, errors.New("period is required")
+	}
+
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	sql, args, err := totalCTE(f)
+	if err != nil {
+		return nil, err
+	}
+	sql = sql + perMonthCTE + `,
+				months AS (
+				SELECT generate_series(?::timestamp, ?::timestamp, interval '1 month')::date AS month
+				)
+				SELECT m.month, COALESCE(SUM(pm.price), 0), COUNT(pm.id)
+				FROM months m
+				LEFT JOIN per_month pm ON pm.month = m.month
+				GROUP BY m.month
+				ORDER BY m.month`
+	args = append(args, *f.Start, *f.End)
+
+	sql, err = sq.Dollar.ReplacePlaceholders(sql)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make([]model.MonthTotal, 0)
+	for rows.Next() {
+		p := model.MonthTotal{}
+		err := rows.Scan(&p.Month, &p.Total, &p.Count)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// CTE per_month: подписки из per_sub, развернутые по месяцам пересечения с периодом
+const perMonthCTE = `,
+				per_month AS (
+				SELECT ps.id, ps.service_name, ps.user_id, ps.price, m::date AS month
+				FROM per_sub ps
+				CROSS JOIN LATERAL generate_series(ps.overlap_start::timestamp, ps.overlap_end::timestamp, interval '1 month') AS m
+				)`
+
+// CTE period и per_sub: подписки, пересекающиеся с периодом, и кол-во месяцев пересечения
+// плейсхолдеры в формате ?, перед выполнением заменить на sq.Dollar
+func totalCTE(f model.Filter) (string, []any, error) {
 	args := make([]any, 0, 4)
 
 	var startdate time.Time
 	var enddate time.Time
-	if start != nil {
-		startdate = *start
+	if f.Start != nil {
+		startdate = *f.Start
 	} else {
 		// если не задали начальную дату
 		startdate = time.Unix(0, 0)
 	}
-	if end != nil {
-		enddate = *end
+	if f.End != nil {
+		enddate = *f.End
 	} else {
 		// если не задали конечную дату
 		enddate = time.Now()
-
 	}
+	args = append(args, startdate, enddate)
 
-	args = append(args, startdate)
-	args = append(args, enddate)
-	index := 2
-
-	// считаем кол-во месяцев и умножаем на стоимость, исключая те, что не попадают по условию
+	// считаем кол-во месяцев, исключая те, что не попадают по условию
 	sql := `WITH period AS (
-				SELECT $1::date AS period_start, $2::date AS period_end
+				SELECT ?::date AS period_start, ?::date AS period_end
 				),
 				per_sub AS (
 				SELECT 
+					s.id,
+					s.service_name,
+					s.user_id,
 					s.price,
+					GREATEST(s.start_date, p.period_start) AS overlap_start,
+					LEAST(COALESCE(s.end_date, p.period_end), p.period_end) AS overlap_end,
 					(
 					(DATE_PART('year', LEAST(COALESCE(s.end_date, p.period_end), p.period_end))
 					- DATE_PART('year', GREATEST(s.start_date, p.period_start))) * 12
@@ -272,26 +733,11 @@ func (r *Repository) SubscriptionTotal(ctx context.Context, user uuid.UUID, serv
 				WHERE s.start_date <= p.period_end
 					AND COALESCE(s.end_date, p.period_end) >= p.period_start`
 
-	if service_name != "" {
-		index++
-		sql = fmt.Sprintf(sql+` AND service_name = $%d`, index)
-		args = append(args, service_name)
-	}
-	if user != uuid.Nil {
-		index++
-		sql = fmt.Sprintf(sql+` AND user_id = $%d`, index)
-		args = append(args, user)
-	}
-
-	sql = sql + ` )
-				SELECT COALESCE(SUM(price * months_in_period), 0) AS total_revenue
-				FROM per_sub;
-				`
-	row := conn.QueryRow(ctx, sql, args...)
-	err = row.Scan(&total)
+	sql, args, err := appendSubFilter(sql, args, "s", f)
 	if err != nil {
-		return 0, err
+		return "", nil, err
 	}
 
-	return total, nil
+	return sql + `
+				)`, args, nil
 }
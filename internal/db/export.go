@@ -0,0 +1,84 @@
+package emsub
+
+import (
+	"context"
+	"strconv"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// сколько строк читать из курсора за раз
+const exportFetch = 1000
+
+// все подписки по фильтру без лимита: серверный курсор, строки отдаются в fn по мере чтения
+func (r *Repository) SubscriptionExport(ctx context.Context, f model.Filter, fn func(model.Subscription) error) error {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sqexport := sq.Select("id", "service_name", "user_id", "price", "start_date", "end_date").
+		From("subscriptions").
+		PlaceholderFormat(sq.Dollar).
+		Where(periodWhere(f.Start, f.End)).
+		OrderBy("service_name ASC", "start_date ASC", "id ASC")
+	if f.UserId != uuid.Nil {
+		sqexport = sqexport.Where(sq.Eq{"user_id": f.UserId})
+	}
+	if len(f.UserIds) > 0 {
+		sqexport = sqexport.Where(sq.Eq{"user_id": f.UserIds})
+	}
+	if f.ServiceName != "" {
+		sqexport = sqexport.Where(sq.Eq{"service_name": f.ServiceName})
+	}
+	if f.Category != "" {
+		sqexport = sqexport.Where("service_name IN (SELECT service_name FROM service_categories WHERE category = ?)", f.Category)
+	}
+	if f.Expr != nil {
+		where, args, err := f.Expr.Where("")
+		if err != nil {
+			return err
+		}
+		sqexport = sqexport.Where(where, args...)
+	}
+	sql, args, err := sqexport.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DECLARE export_cursor NO SCROLL CURSOR FOR `+sql, args...)
+	if err != nil {
+		return err
+	}
+	for {
+		rows, err := tx.Query(ctx, `FETCH FORWARD `+strconv.Itoa(exportFetch)+` FROM export_cursor`)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for rows.Next() {
+			sub := model.Subscription{}
+			err = rows.Scan(&sub.Id, &sub.ServiceName, &sub.UserId, &sub.Price, &sub.StartDate, &sub.EndDate)
+			if err == nil {
+				err = fn(sub)
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			n++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if n < exportFetch {
+			return nil
+		}
+	}
+}
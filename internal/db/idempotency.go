@@ -0,0 +1,91 @@
+package emsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// захват Idempotency-Key: вставка новой записи или перезапись истекшей / зависшей
+func (r *Repository) IdempotencyStart(ctx context.Context, rec *model.IdempotencyRecord, ttl, lock time.Duration) (*model.IdempotencyRecord, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	// заодно чистим истекшие ключи
+	_, err = conn.Exec(ctx, "DELETE FROM idempotency_keys WHERE expires_at < now()")
+	if err != nil {
+		return nil, err
+	}
+
+	// ключ могли удалить между вставкой и чтением - тогда захватываем снова
+	for retry := true; ; retry = false {
+		err = conn.QueryRow(ctx, `INSERT INTO idempotency_keys (scope, key, request_hash, expires_at)
+			VALUES ($1, $2, $3, now() + make_interval(secs => $4))
+			ON CONFLICT (scope, key) DO UPDATE SET request_hash = EXCLUDED.request_hash, status = 0,
+				content_type = '', body = NULL, created_at = now(), expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at < now()
+				OR (idempotency_keys.status = 0 AND idempotency_keys.created_at < now() - make_interval(secs => $5))
+			RETURNING created_at`,
+			rec.Scope, rec.Key, rec.RequestHash, ttl.Seconds(), lock.Seconds()).Scan(&rec.CreatedAt)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+
+		// ключ занят: сохраненный ответ или запрос в работе
+		saved := &model.IdempotencyRecord{Scope: rec.Scope, Key: rec.Key}
+		err = conn.QueryRow(ctx, `SELECT request_hash, status, content_type, body FROM idempotency_keys
+			WHERE scope = $1 AND key = $2`, rec.Scope, rec.Key).Scan(&saved.RequestHash, &saved.Status, &saved.ContentType, &saved.Body)
+		if errors.Is(err, pgx.ErrNoRows) && retry {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return saved, nil
+	}
+}
+
+// сохранение ответа на запрос
+func (r *Repository) IdempotencySave(ctx context.Context, rec model.IdempotencyRecord) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	// ключ могли перезаписать, если запрос выполнялся дольше блокировки
+	cmdTag, err := conn.Exec(ctx, `UPDATE idempotency_keys SET status = $5, content_type = $6, body = $7
+		WHERE scope = $1 AND key = $2 AND request_hash = $3 AND created_at = $4`,
+		rec.Scope, rec.Key, rec.RequestHash, rec.CreatedAt, rec.Status, rec.ContentType, rec.Body)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return fmt.Errorf("idempotency key %w", model.ErrNotFound)
+	}
+	return nil
+}
+
+// освобождение ключа: запрос можно повторить
+func (r *Repository) IdempotencyDelete(ctx context.Context, rec model.IdempotencyRecord) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `DELETE FROM idempotency_keys
+		WHERE scope = $1 AND key = $2 AND request_hash = $3 AND created_at = $4`,
+		rec.Scope, rec.Key, rec.RequestHash, rec.CreatedAt)
+	return err
+}
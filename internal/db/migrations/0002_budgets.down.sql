@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_budgets_user;
+DROP TABLE IF EXISTS budgets;
+DROP INDEX IF EXISTS idx_service_categories_category;
+DROP TABLE IF EXISTS service_categories;
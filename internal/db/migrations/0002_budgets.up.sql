@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS service_categories (
+    service_name    TEXT    PRIMARY KEY,
+    category        TEXT    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_categories_category ON service_categories(category);
+
+CREATE TABLE IF NOT EXISTS budgets (
+    id                      UUID    PRIMARY KEY,
+    user_id                 UUID    NOT NULL,
+    amount                  INTEGER NOT NULL CHECK (amount > 0),
+    service_name            TEXT,
+    category                TEXT,
+    threshold               INTEGER CHECK (threshold > 0 AND threshold <= 100),
+    alert_current_month     DATE,
+    alert_projected_month   DATE,
+    CHECK (service_name IS NULL OR category IS NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_budgets_user ON budgets(user_id);
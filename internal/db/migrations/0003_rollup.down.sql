@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_monthly_rollup_service;
+DROP INDEX IF EXISTS idx_monthly_rollup_user;
+DROP TABLE IF EXISTS monthly_rollup;
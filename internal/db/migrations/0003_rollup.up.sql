@@ -0,0 +1,27 @@
+-- изменения месячной стоимости: +price в месяце начала подписки, -price в месяце после окончания
+-- стоимость за месяц M - сумма amount_delta по месяцам <= M
+CREATE TABLE IF NOT EXISTS monthly_rollup (
+    month           DATE    NOT NULL,
+    service_name    TEXT    NOT NULL,
+    user_id         UUID    NOT NULL,
+    amount_delta    BIGINT  NOT NULL DEFAULT 0,
+    started         INTEGER NOT NULL DEFAULT 0,
+    ended           INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (month, service_name, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_monthly_rollup_user ON monthly_rollup(user_id);
+CREATE INDEX IF NOT EXISTS idx_monthly_rollup_service ON monthly_rollup(service_name);
+
+INSERT INTO monthly_rollup (month, service_name, user_id, amount_delta, started, ended)
+SELECT month, service_name, user_id, SUM(amount_delta), SUM(started), SUM(ended)
+FROM (
+    SELECT date_trunc('month', start_date)::date AS month, service_name, user_id, price::bigint AS amount_delta, 1 AS started, 0 AS ended
+    FROM subscriptions
+    UNION ALL
+    SELECT (date_trunc('month', end_date) + interval '1 month')::date, service_name, user_id, -price::bigint, 0, 1
+    FROM subscriptions
+    WHERE end_date IS NOT NULL
+) d
+GROUP BY month, service_name, user_id
+ON CONFLICT DO NOTHING;
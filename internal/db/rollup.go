@@ -0,0 +1,266 @@
+package emsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	utils "github.com/glkeru/EM_Subscriptions/internal/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// помесячный агрегат monthly_rollup хранит изменения стоимости по (месяц, сервис, пользователь):
+// подписка дает +price и started = 1 в месяце начала, -price и ended = 1 в месяце после окончания
+
+// агрегат по подпискам из subscriptions
+const rollupExpected = `SELECT month, service_name, user_id,
+					SUM(amount_delta)::bigint AS amount_delta, SUM(started)::int AS started, SUM(ended)::int AS ended
+				FROM (
+					SELECT date_trunc('month', start_date)::date AS month, service_name, user_id, price::bigint AS amount_delta, 1 AS started, 0 AS ended
+					FROM subscriptions
+					UNION ALL
+					SELECT (date_trunc('month', end_date) + interval '1 month')::date, service_name, user_id, -price::bigint, 0, 1
+					FROM subscriptions
+					WHERE end_date IS NOT NULL
+				) d
+				GROUP BY month, service_name, user_id`
+
+// можно ли посчитать сумму по агрегату при таких фильтрах
+func (r *Repository) rollupAllowed(f model.Filter) bool {
+	// в агрегате нет цен и дат подписок для условий filter
+	return r.config.Rollup && f.Expr == nil
+}
+
+// изменение строки агрегата
+type rollupDelta struct {
+	month   time.Time
+	amount  int64
+	started int
+	ended   int
+}
+
+// изменения агрегата от подписки: sign = 1 - добавить, -1 - убрать
+func rollupDeltas(s model.Subscription, sign int) []rollupDelta {
+	price := int64(s.Price) * int64(sign)
+	deltas := []rollupDelta{{utils.MonthStart(s.StartDate), price, sign, 0}}
+	if s.EndDate != nil {
+		deltas = append(deltas, rollupDelta{utils.MonthStart(*s.EndDate).AddDate(0, 1, 0), -price, 0, sign})
+	}
+	return deltas
+}
+
+// учет подписки в агрегате: sign = 1 - добавить, -1 - убрать
+func rollupApply(ctx context.Context, tx pgx.Tx, s model.Subscription, sign int) error {
+	for _, d := range rollupDeltas(s, sign) {
+		err := rollupAdd(ctx, tx, s, d)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rollupAdd(ctx context.Context, tx pgx.Tx, s model.Subscription, d rollupDelta) error {
+	_, err := tx.Exec(ctx, `INSERT INTO monthly_rollup (month, service_name, user_id, amount_delta, started, ended)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (month, service_name, user_id) DO UPDATE SET
+			amount_delta = monthly_rollup.amount_delta + EXCLUDED.amount_delta,
+			started = monthly_rollup.started + EXCLUDED.started,
+			ended = monthly_rollup.ended + EXCLUDED.ended`,
+		d.month, s.ServiceName, s.UserId, d.amount, d.started, d.ended)
+	if err != nil {
+		return err
+	}
+
+	// пустые строки не храним
+	_, err = tx.Exec(ctx, `DELETE FROM monthly_rollup
+		WHERE month = $1 AND service_name = $2 AND user_id = $3
+			AND amount_delta = 0 AND started = 0 AND ended = 0`,
+		d.month, s.ServiceName, s.UserId)
+	return err
+}
+
+// период агрегата: месяцы начала и окончания, по умолчанию как в totalCTE
+func rollupPeriod(f model.Filter) (time.Time, time.Time) {
+	start := time.Unix(0, 0)
+	end := time.Now()
+	if f.Start != nil {
+		start = *f.Start
+	}
+	if f.End != nil {
+		end = *f.End
+	}
+	return utils.MonthStart(start), utils.MonthStart(end)
+}
+
+// кол-во месяцев от GREATEST(r.month, start) до end включительно
+const rollupMonths = `(
+					(DATE_PART('year', ?::date) - DATE_PART('year', GREATEST(r.month, ?::date))) * 12
+					+ DATE_PART('month', ?::date) - DATE_PART('month', GREATEST(r.month, ?::date)) + 1
+					)::int`
+
+// стоимость подписок по агрегату
+func (r *Repository) rollupTotal(ctx context.Context, conn *pgxpool.Conn, f model.Filter) (uint, error) {
+	start, end := rollupPeriod(f)
+
+	args := []any{end, start, end, start, end}
+	sql := `SELECT COALESCE(SUM(r.amount_delta * ` + rollupMonths + `), 0)::bigint
+				FROM monthly_rollup r
+				WHERE r.month <= ?::date`
+	sql, args, err := appendSubFilter(sql, args, "r", f)
+	if err != nil {
+		return 0, err
+	}
+
+	sql, err = sq.Dollar.ReplacePlaceholders(sql)
+	if err != nil {
+		return 0, err
+	}
+	var total uint
+	err = conn.QueryRow(ctx, sql, args...).Scan(&total)
+	return total, err
+}
+
+// разбивка стоимости по агрегату, результат совпадает с SubscriptionTotalGroup по подпискам
+func (r *Repository) rollupTotalGroup(ctx context.Context, conn *pgxpool.Conn, f model.Filter, groupBy []string) ([]model.TotalGroup, error) {
+	start, end := rollupPeriod(f)
+
+	service, user, month := "NULL::text", "NULL::uuid", "NULL::date"
+	exprs := make([]string, 0, len(groupBy))
+	cols := make([]string, 0, len(groupBy))
+	for _, g := range groupBy {
+		switch g {
+		case model.GroupService:
+			service = "r.service_name"
+			exprs = append(exprs, service)
+		case model.GroupUser:
+			user = "r.user_id"
+			exprs = append(exprs, user)
+		case model.GroupMonth:
+			month = "m.month"
+			exprs = append(exprs, month)
+		default:
+			return nil, fmt.Errorf("unknown group %q", g)
+		}
+		cols = append(cols, g)
+	}
+	if len(cols) == 0 {
+		return nil, errors.New("group is required")
+	}
+
+	var sql string
+	var args []any
+	var err error
+	if month != "NULL::date" {
+		// стоимость и кол-во активных подписок в месяце - накопленные суммы изменений
+		args = []any{start, end}
+		sql = fmt.Sprintf(`WITH months AS (
+				SELECT generate_series(GREATEST(?::date, (SELECT MIN(month) FROM monthly_rollup))::timestamp, ?::timestamp, interval '1 month')::date AS month
+				)
+				SELECT %s AS service_name, %s AS user_id, %s AS month,
+					SUM(r.amount_delta)::bigint AS total, SUM(r.started - r.ended)::bigint AS cnt
+				FROM months m
+				JOIN monthly_rollup r ON r.month <= m.month`, service, user, month)
+		sql, args, err = appendSubFilter(sql, args, "r", f)
+	} else {
+		// подписки, пересекающиеся с периодом: начатые до конца периода минус закончившиеся до его начала
+		args = []any{end, start, end, start, start, end}
+		sql = fmt.Sprintf(`SELECT %s AS service_name, %s AS user_id, %s AS month,
+					COALESCE(SUM(r.amount_delta * `+rollupMonths+`), 0)::bigint AS total,
+					SUM(r.started) - COALESCE(SUM(r.ended) FILTER (WHERE r.month <= ?::date), 0) AS cnt
+				FROM monthly_rollup r
+				WHERE r.month <= ?::date`, service, user, month)
+		sql, args, err = appendSubFilter(sql, args, "r", f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sql = `SELECT service_name, user_id, month, total, cnt FROM (` + sql +
+		` GROUP BY ` + strings.Join(exprs, ", ") + `) g WHERE g.cnt > 0 ORDER BY ` + strings.Join(cols, ", ")
+
+	sql, err = sq.Dollar.ReplacePlaceholders(sql)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make([]model.TotalGroup, 0)
+	for rows.Next() {
+		g := model.TotalGroup{}
+		err := rows.Scan(&g.ServiceName, &g.UserId, &g.Month, &g.Total, &g.Count)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// сверка агрегата с подписками, возвращает расходящиеся строки
+func (r *Repository) RollupCheck(ctx context.Context) ([]model.RollupDiff, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, `WITH expected AS (`+rollupExpected+`)
+				SELECT COALESCE(e.month, a.month), COALESCE(e.service_name, a.service_name), COALESCE(e.user_id, a.user_id),
+					COALESCE(e.amount_delta, 0), COALESCE(a.amount_delta, 0),
+					COALESCE(e.started - e.ended, 0), COALESCE(a.started - a.ended, 0)
+				FROM expected e
+				FULL JOIN monthly_rollup a ON a.month = e.month AND a.service_name = e.service_name AND a.user_id = e.user_id
+				WHERE e.amount_delta IS DISTINCT FROM a.amount_delta
+					OR e.started IS DISTINCT FROM a.started
+					OR e.ended IS DISTINCT FROM a.ended
+				ORDER BY 1, 2, 3`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	diffs := make([]model.RollupDiff, 0)
+	for rows.Next() {
+		d := model.RollupDiff{}
+		err := rows.Scan(&d.Month, &d.ServiceName, &d.UserId, &d.ExpectedAmount, &d.ActualAmount, &d.ExpectedCount, &d.ActualCount)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, rows.Err()
+}
+
+// пересборка агрегата по подпискам
+func (r *Repository) RollupRebuild(ctx context.Context) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// блокируем запись подписок на время пересборки
+	_, err = tx.Exec(ctx, "LOCK TABLE subscriptions IN SHARE MODE")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM monthly_rollup")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO monthly_rollup (month, service_name, user_id, amount_delta, started, ended) `+rollupExpected)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
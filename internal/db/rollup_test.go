@@ -0,0 +1,157 @@
+package emsub
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/google/uuid"
+)
+
+func month(m time.Month, y int) time.Time {
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestRollupDeltas(t *testing.T) {
+	end := time.Date(2025, time.December, 17, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		sub  model.Subscription
+		sign int
+		want []rollupDelta
+	}{
+		{
+			"open",
+			model.Subscription{Price: 400, StartDate: month(7, 2025)},
+			1,
+			[]rollupDelta{{month(7, 2025), 400, 1, 0}},
+		},
+		// окончание в декабре - снятие в январе следующего года, даты приводятся к началу месяца
+		{
+			"closed",
+			model.Subscription{Price: 400, StartDate: time.Date(2025, time.July, 15, 0, 0, 0, 0, time.UTC), EndDate: &end},
+			1,
+			[]rollupDelta{{month(7, 2025), 400, 1, 0}, {month(1, 2026), -400, 0, 1}},
+		},
+		{
+			"remove",
+			model.Subscription{Price: 400, StartDate: month(7, 2025), EndDate: &end},
+			-1,
+			[]rollupDelta{{month(7, 2025), -400, -1, 0}, {month(1, 2026), 400, 0, -1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rollupDeltas(tt.sub, tt.sign)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deltas = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// агрегат в памяти: как rollupAdd, без пустых строк
+type memRollup map[time.Time]rollupDelta
+
+func (r memRollup) apply(s model.Subscription, sign int) {
+	for _, d := range rollupDeltas(s, sign) {
+		row := r[d.month]
+		row.amount += d.amount
+		row.started += d.started
+		row.ended += d.ended
+		if row.amount == 0 && row.started == 0 && row.ended == 0 {
+			delete(r, d.month)
+			continue
+		}
+		r[d.month] = row
+	}
+}
+
+// стоимость и кол-во активных подписок в месяце - накопленные суммы, как в rollupTotalGroup
+func (r memRollup) at(m time.Time) (int64, int) {
+	var amount int64
+	var count int
+	for month, d := range r {
+		if !month.After(m) {
+			amount += d.amount
+			count += d.started - d.ended
+		}
+	}
+	return amount, count
+}
+
+func TestRollupAccumulation(t *testing.T) {
+	user := uuid.New()
+	end := month(9, 2025)
+	subs := []model.Subscription{
+		{ServiceName: "Okko", UserId: user, Price: 400, StartDate: month(7, 2025), EndDate: &end},
+		{ServiceName: "Okko", UserId: user, Price: 100, StartDate: month(8, 2025)},
+		{ServiceName: "Okko", UserId: user, Price: 50, StartDate: month(10, 2025), EndDate: ptr(month(10, 2025))},
+	}
+	r := memRollup{}
+	for _, s := range subs {
+		r.apply(s, 1)
+	}
+
+	tests := []struct {
+		month  time.Time
+		amount int64
+		count  int
+	}{
+		{month(6, 2025), 0, 0},
+		{month(7, 2025), 400, 1},
+		{month(8, 2025), 500, 2},
+		{month(9, 2025), 500, 2},
+		{month(10, 2025), 150, 2},
+		{month(11, 2025), 100, 1},
+		{month(1, 2030), 100, 1},
+	}
+	for _, tt := range tests {
+		amount, count := r.at(tt.month)
+		if amount != tt.amount || count != tt.count {
+			t.Errorf("%s: amount %d, count %d, want %d, %d", tt.month.Format("01-2006"), amount, count, tt.amount, tt.count)
+		}
+	}
+
+	// обновление - снятие старой версии и учет новой; удаление всех подписок оставляет пустой агрегат
+	updated := subs[1]
+	updated.Price = 300
+	updated.EndDate = ptr(month(8, 2025))
+	r.apply(subs[1], -1)
+	r.apply(updated, 1)
+	if amount, count := r.at(month(8, 2025)); amount != 700 || count != 2 {
+		t.Errorf("after update 08-2025: amount %d, count %d, want 700, 2", amount, count)
+	}
+	if amount, count := r.at(month(9, 2025)); amount != 400 || count != 1 {
+		t.Errorf("after update 09-2025: amount %d, count %d, want 400, 1", amount, count)
+	}
+
+	r.apply(subs[0], -1)
+	r.apply(updated, -1)
+	r.apply(subs[2], -1)
+	if len(r) != 0 {
+		t.Errorf("rollup is not empty after removing all subscriptions: %+v", r)
+	}
+}
+
+func TestRollupPeriod(t *testing.T) {
+	start := time.Date(2025, time.March, 20, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, time.May, 2, 0, 0, 0, 0, time.UTC)
+
+	s, e := rollupPeriod(model.Filter{Start: &start, End: &end})
+	if !s.Equal(month(3, 2025)) || !e.Equal(month(5, 2025)) {
+		t.Errorf("period = %v - %v", s, e)
+	}
+
+	// по умолчанию: с начала эпохи (в местном поясе может быть 12-1969) по текущий месяц
+	now := time.Now()
+	s, e = rollupPeriod(model.Filter{})
+	if s.After(month(1, 1970)) || !e.Equal(month(now.Month(), now.Year())) {
+		t.Errorf("default period = %v - %v", s, e)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
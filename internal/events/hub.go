@@ -0,0 +1,110 @@
+package emsub
+
+import (
+	"sync"
+	"time"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+)
+
+// очередь подписчика: при переполнении подписчик отключается и продолжает с Last-Event-ID
+const SubscriberQueue = 64
+
+// события в памяти процесса: кольцевой буфер для повтора и рассылка подписчикам
+type Hub struct {
+	mu     sync.Mutex
+	buf    []model.SubscriptionEvent
+	next   int // позиция записи в buf
+	lastId uint64
+	subs   map[chan model.SubscriptionEvent]struct{}
+	closed bool
+}
+
+func NewHub(size int) *Hub {
+	if size < 1 {
+		size = 1
+	}
+	return &Hub{
+		buf:  make([]model.SubscriptionEvent, 0, size),
+		subs: make(map[chan model.SubscriptionEvent]struct{}),
+	}
+}
+
+func (h *Hub) Publish(eventType string, sub model.Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+
+	h.lastId++
+	e := model.SubscriptionEvent{Id: h.lastId, Type: eventType, Time: time.Now(), Subscription: sub}
+	if len(h.buf) < cap(h.buf) {
+		h.buf = append(h.buf, e)
+	} else {
+		h.buf[h.next] = e
+	}
+	h.next = (h.next + 1) % cap(h.buf)
+
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			// отстающий подписчик
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *Hub) Subscribe(lastId uint64) ([]model.SubscriptionEvent, bool, <-chan model.SubscriptionEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan model.SubscriptionEvent, SubscriberQueue)
+	if h.closed {
+		close(ch)
+		return nil, true, ch, func() {}
+	}
+	h.subs[ch] = struct{}{}
+
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+
+	// новый подписчик или id из другого процесса
+	if lastId == 0 {
+		return nil, true, ch, cancel
+	}
+	if lastId > h.lastId {
+		return nil, false, ch, cancel
+	}
+
+	replay := make([]model.SubscriptionEvent, 0)
+	oldest := h.lastId + 1
+	for i := range h.buf {
+		// от самого старого события к новому
+		e := h.buf[(h.next+i)%len(h.buf)]
+		oldest = min(oldest, e.Id)
+		if e.Id > lastId {
+			replay = append(replay, e)
+		}
+	}
+	return replay, oldest <= lastId+1, ch, cancel
+}
+
+// закрывает каналы подписчиков, чтобы открытые потоки не держали остановку сервера
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,85 @@
+package emsub
+
+import (
+	"context"
+
+	interfaces "github.com/glkeru/EM_Subscriptions/internal/interfaces"
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"github.com/google/uuid"
+)
+
+// репозиторий, публикующий изменения подписок: события получают все API сервиса
+type Repository struct {
+	interfaces.Repository
+	events interfaces.Events
+}
+
+func NewRepository(repo interfaces.Repository, events interfaces.Events) *Repository {
+	return &Repository{repo, events}
+}
+
+func (r *Repository) SubscriptionCreate(ctx context.Context, s model.Subscription) (uuid.UUID, error) {
+	id, err := r.Repository.SubscriptionCreate(ctx, s)
+	if err != nil {
+		return id, err
+	}
+	s.Id = id
+	r.events.Publish(model.EventCreated, s)
+	return id, nil
+}
+
+func (r *Repository) SubscriptionUpdate(ctx context.Context, s model.Subscription) error {
+	err := r.Repository.SubscriptionUpdate(ctx, s)
+	if err != nil {
+		return err
+	}
+	r.events.Publish(model.EventUpdated, s)
+	return nil
+}
+
+// после частичного обновления в событие идет подписка целиком
+func (r *Repository) SubscriptionPatch(ctx context.Context, id uuid.UUID, p model.SubscriptionPatch) error {
+	err := r.Repository.SubscriptionPatch(ctx, id, p)
+	if err != nil {
+		return err
+	}
+	r.publishPatched(ctx, id)
+	return nil
+}
+
+func (r *Repository) SubscriptionPatchWith(ctx context.Context, id uuid.UUID, fn func(model.Subscription) (model.SubscriptionPatch, error)) error {
+	changed := false
+	err := r.Repository.SubscriptionPatchWith(ctx, id, func(sub model.Subscription) (model.SubscriptionPatch, error) {
+		p, err := fn(sub)
+		changed = !p.Empty()
+		return p, err
+	})
+	if err != nil || !changed {
+		return err
+	}
+	r.publishPatched(ctx, id)
+	return nil
+}
+
+func (r *Repository) publishPatched(ctx context.Context, id uuid.UUID) {
+	sub, err := r.Repository.SubscriptionRead(ctx, id)
+	if err != nil {
+		// подписку успели удалить - об этом будет свое событие
+		return
+	}
+	r.events.Publish(model.EventUpdated, *sub)
+}
+
+// удаленную подписку читаем заранее: по user_id и service_name фильтруются события
+func (r *Repository) SubscriptionDelete(ctx context.Context, id uuid.UUID) error {
+	sub, err := r.Repository.SubscriptionRead(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = r.Repository.SubscriptionDelete(ctx, id)
+	if err != nil {
+		return err
+	}
+	r.events.Publish(model.EventDeleted, *sub)
+	return nil
+}
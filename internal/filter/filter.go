@@ -0,0 +1,284 @@
+package emsub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	utils "github.com/glkeru/EM_Subscriptions/internal/utils"
+	validate "github.com/glkeru/EM_Subscriptions/internal/validate"
+	"github.com/google/uuid"
+)
+
+// Язык параметра filter:
+//
+//	price > 100 and (service_name starts "Yandex" or service_name in ("Netflix", "Okko"))
+//	end_date = null or end_date >= "06-2025"
+//
+// Условие: поле, оператор и значение. Операторы: = != < > <= >= in starts contains,
+// условия объединяются and и or (and связывает сильнее), порядок задается скобками.
+// Строки и даты (MM-YYYY) - в кавычках, числа - без. starts и contains без учета регистра.
+// Бессрочная подписка (end_date = null) считается закончившейся позже любой даты.
+
+// ограничения на выражение
+const (
+	MaxLength     = 1000
+	MaxConditions = 50
+	MaxDepth      = 10
+)
+
+// типы полей
+const (
+	kindNumber = iota
+	kindString
+	kindDate
+	kindUUID
+)
+
+// разрешенные поля и операторы
+var fields = map[string]int{
+	"price":        kindNumber,
+	"service_name": kindString,
+	"start_date":   kindDate,
+	"end_date":     kindDate,
+	"user_id":      kindUUID,
+}
+
+var fieldNames = "price, service_name, start_date, end_date, user_id"
+
+var operators = map[int][]string{
+	kindNumber: {"=", "!=", "<", ">", "<=", ">=", "in"},
+	kindString: {"=", "!=", "<", ">", "<=", ">=", "in", "starts", "contains"},
+	kindDate:   {"=", "!=", "<", ">", "<=", ">=", "in"},
+	kindUUID:   {"=", "!=", "in"},
+}
+
+// ошибка разбора с позицией в выражении (с 1)
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("filter: %s at position %d", e.Msg, e.Pos+1)
+}
+
+// разбор выражения
+func Parse(src string) (Expr, error) {
+	if len(src) > MaxLength {
+		return nil, &ParseError{MaxLength, fmt.Sprintf("expression is longer than %d characters", MaxLength)}
+	}
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	e, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &ParseError{t.pos, fmt.Sprintf("expected and, or or end of expression, got %s", t)}
+	}
+	// условие собирается при разборе, дальше Where ошибок не возвращает
+	if _, _, err := e.Where(""); err != nil {
+		return nil, &ParseError{0, err.Error()}
+	}
+	return e, nil
+}
+
+type parser struct {
+	tokens     []token
+	i          int
+	conditions int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == tokIdent && strings.EqualFold(t.text, word) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// or: and {"or" and}
+func (p *parser) or(depth int) (Expr, error) {
+	left, err := p.and(depth)
+	if err != nil {
+		return nil, err
+	}
+	items := []Expr{left}
+	for p.keyword("or") {
+		right, err := p.and(depth)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, right)
+	}
+	if len(items) == 1 {
+		return left, nil
+	}
+	return &group{"OR", items}, nil
+}
+
+// and: term {"and" term}
+func (p *parser) and(depth int) (Expr, error) {
+	left, err := p.term(depth)
+	if err != nil {
+		return nil, err
+	}
+	items := []Expr{left}
+	for p.keyword("and") {
+		right, err := p.term(depth)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, right)
+	}
+	if len(items) == 1 {
+		return left, nil
+	}
+	return &group{"AND", items}, nil
+}
+
+// term: "(" or ")" | condition
+func (p *parser) term(depth int) (Expr, error) {
+	t := p.peek()
+	if t.kind != tokPunct || t.text != "(" {
+		return p.condition()
+	}
+	if depth >= MaxDepth {
+		return nil, &ParseError{t.pos, fmt.Sprintf("parentheses are nested deeper than %d", MaxDepth)}
+	}
+	p.next()
+	e, err := p.or(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.next(); t.kind != tokPunct || t.text != ")" {
+		return nil, &ParseError{t.pos, fmt.Sprintf("expected \")\", got %s", t)}
+	}
+	return e, nil
+}
+
+// condition: field operator value | field "in" "(" value {"," value} ")"
+func (p *parser) condition() (Expr, error) {
+	t := p.next()
+	if t.kind != tokIdent {
+		return nil, &ParseError{t.pos, fmt.Sprintf("expected field, got %s", t)}
+	}
+	name := strings.ToLower(t.text)
+	kind, ok := fields[name]
+	if !ok {
+		return nil, &ParseError{t.pos, fmt.Sprintf("unknown field %q, allowed: %s", t.text, fieldNames)}
+	}
+	p.conditions++
+	if p.conditions > MaxConditions {
+		return nil, &ParseError{t.pos, fmt.Sprintf("more than %d conditions", MaxConditions)}
+	}
+
+	opt := p.next()
+	op := strings.ToLower(opt.text)
+	if op == "<>" {
+		op = "!="
+	}
+	if (opt.kind != tokOp && opt.kind != tokIdent) || !allowed(kind, op) {
+		return nil, &ParseError{opt.pos, fmt.Sprintf("expected operator for %s (%s), got %s", name, strings.Join(operators[kind], " "), opt)}
+	}
+
+	c := &condition{field: name, op: op, kind: kind}
+	if op != "in" {
+		v, err := p.value(name, kind, op)
+		if err != nil {
+			return nil, err
+		}
+		c.values = []any{v}
+		return c, nil
+	}
+
+	if t := p.next(); t.kind != tokPunct || t.text != "(" {
+		return nil, &ParseError{t.pos, fmt.Sprintf("expected \"(\" after in, got %s", t)}
+	}
+	for {
+		v, err := p.value(name, kind, op)
+		if err != nil {
+			return nil, err
+		}
+		c.values = append(c.values, v)
+		t := p.next()
+		if t.kind == tokPunct && t.text == ")" {
+			return c, nil
+		}
+		if t.kind != tokPunct || t.text != "," {
+			return nil, &ParseError{t.pos, fmt.Sprintf("expected \",\" or \")\", got %s", t)}
+		}
+	}
+}
+
+// значение поля: nil - null для end_date
+func (p *parser) value(name string, kind int, op string) (any, error) {
+	t := p.next()
+	if t.kind == tokIdent && strings.EqualFold(t.text, "null") {
+		if name != "end_date" || (op != "=" && op != "!=") {
+			return nil, &ParseError{t.pos, "null is allowed only in end_date = null and end_date != null"}
+		}
+		return nil, nil
+	}
+
+	switch kind {
+	case kindNumber:
+		if t.kind != tokNumber {
+			return nil, &ParseError{t.pos, fmt.Sprintf("%s expects a number, got %s", name, t)}
+		}
+		n, err := strconv.ParseUint(t.text, 10, 31)
+		if err != nil {
+			return nil, &ParseError{t.pos, fmt.Sprintf("%s value %s is out of range", name, t.text)}
+		}
+		return n, nil
+	case kindDate:
+		if t.kind != tokString {
+			return nil, &ParseError{t.pos, fmt.Sprintf("%s expects a quoted date MM-YYYY, got %s", name, t)}
+		}
+		dt, err := utils.ParseDate(t.text, validate.DateFormat)
+		if err != nil {
+			return nil, &ParseError{t.pos, fmt.Sprintf("invalid date %q, expected MM-YYYY", t.text)}
+		}
+		return dt, nil
+	case kindUUID:
+		if t.kind != tokString {
+			return nil, &ParseError{t.pos, fmt.Sprintf("%s expects a quoted UUID, got %s", name, t)}
+		}
+		id, err := uuid.Parse(t.text)
+		if err != nil {
+			return nil, &ParseError{t.pos, fmt.Sprintf("invalid UUID %q", t.text)}
+		}
+		return id, nil
+	default:
+		if t.kind != tokString {
+			return nil, &ParseError{t.pos, fmt.Sprintf("%s expects a quoted string, got %s", name, t)}
+		}
+		return t.text, nil
+	}
+}
+
+func allowed(kind int, op string) bool {
+	for _, o := range operators[kind] {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
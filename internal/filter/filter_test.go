@@ -0,0 +1,136 @@
+package emsub
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseWhere(t *testing.T) {
+	june := time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+	user := uuid.MustParse("60601fee-2bf1-4721-ae6f-7636e79a0cba")
+
+	tests := []struct {
+		src  string
+		sql  string
+		args []any
+	}{
+		{`price > 100`, `s.price > ?`, []any{uint64(100)}},
+		{`PRICE >= 1 AND Service_Name = 'Okko'`, `(s.price >= ? AND s.service_name = ?)`, []any{uint64(1), "Okko"}},
+		{`service_name <> "x"`, `s.service_name <> ?`, []any{"x"}},
+		// and связывает сильнее or
+		{
+			`price < 5 or price > 10 and service_name = "a"`,
+			`(s.price < ? OR (s.price > ? AND s.service_name = ?))`,
+			[]any{uint64(5), uint64(10), "a"},
+		},
+		{
+			`price > 100 and (service_name starts "Yandex" or service_name in ("Netflix", "Okko"))`,
+			`(s.price > ? AND (s.service_name ILIKE ? OR s.service_name IN (?,?)))`,
+			[]any{uint64(100), "Yandex%", "Netflix", "Okko"},
+		},
+		// спецсимволы LIKE экранируются
+		{`service_name starts "Ya_%"`, `s.service_name ILIKE ?`, []any{`Ya\_\%%`}},
+		{`service_name contains "a\\b"`, `s.service_name ILIKE ?`, []any{`%a\\b%`}},
+		{`user_id in ("60601fee-2bf1-4721-ae6f-7636e79a0cba")`, `s.user_id IN (?)`, []any{user}},
+		{`start_date = "06-2025"`, `s.start_date = ?`, []any{june}},
+
+		// бессрочная подписка заканчивается позже любой даты
+		{`end_date = null`, `s.end_date IS NULL`, nil},
+		{`end_date != null`, `s.end_date IS NOT NULL`, nil},
+		{`end_date < "06-2025"`, `s.end_date < ?`, []any{june}},
+		{`end_date <= "06-2025"`, `s.end_date <= ?`, []any{june}},
+		{`end_date > "06-2025"`, `(s.end_date > ? OR s.end_date IS NULL)`, []any{june}},
+		{`end_date >= "06-2025"`, `(s.end_date >= ? OR s.end_date IS NULL)`, []any{june}},
+		{`end_date != "06-2025"`, `(s.end_date <> ? OR s.end_date IS NULL)`, []any{june}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			sql, args, err := e.Where("s")
+			if err != nil {
+				t.Fatalf("Where: %v", err)
+			}
+			if sql != tt.sql {
+				t.Errorf("sql = %q, want %q", sql, tt.sql)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %#v, want %#v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestWhereWithoutAlias(t *testing.T) {
+	e, err := Parse(`price = 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, _, err := e.Where("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql != "price = ?" {
+		t.Errorf("sql = %q", sql)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int // с 1, как в тексте ошибки
+		msg string
+	}{
+		{``, 1, "expected field, got end of expression"},
+		{`foo = 1`, 1, `unknown field "foo"`},
+		{`price`, 6, "expected operator for price"},
+		{`price ~ 1`, 7, `unexpected character '~'`},
+		{`price ! 1`, 7, `did you mean "!="`},
+		{`user_id starts "a"`, 9, "expected operator for user_id (= != in)"},
+		{`price >`, 8, "price expects a number, got end of expression"},
+		{`price > "1"`, 9, `price expects a number, got string "1"`},
+		{`price = 1.5`, 10, `unexpected character '.'`},
+		{`price > 99999999999`, 9, "out of range"},
+		{`service_name = 5`, 16, "service_name expects a quoted string"},
+		{`service_name = "abc`, 16, "unterminated string"},
+		{`start_date = "13-2025"`, 14, `invalid date "13-2025"`},
+		{`start_date = 2025`, 14, "start_date expects a quoted date"},
+		{`user_id = "x"`, 11, `invalid UUID "x"`},
+		{`start_date = null`, 14, "null is allowed only in end_date"},
+		{`end_date > null`, 12, "null is allowed only in end_date"},
+		{`price in 1`, 10, `expected "(" after in`},
+		{`price in (1 2)`, 13, `expected "," or ")"`},
+		{`(price > 1`, 11, `expected ")"`},
+		{`price > 1 price`, 11, "expected and, or or end of expression"},
+		{`price > 1 and`, 14, "expected field"},
+		{strings.Repeat("(", MaxDepth+1) + "price > 1" + strings.Repeat(")", MaxDepth+1), MaxDepth + 1, "nested deeper"},
+		{strings.Repeat("price = 1 or ", MaxConditions) + "price = 1", MaxConditions*13 + 1, "more than 50 conditions"},
+		{strings.Repeat(" ", MaxLength+1), MaxLength + 1, "longer than"},
+	}
+	for _, tt := range tests {
+		name := tt.src
+		if len(name) > 40 {
+			name = name[:40]
+		}
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(tt.src)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("err = %v, want *ParseError", err)
+			}
+			if perr.Pos+1 != tt.pos {
+				t.Errorf("pos = %d, want %d (%v)", perr.Pos+1, tt.pos, err)
+			}
+			if !strings.Contains(perr.Msg, tt.msg) {
+				t.Errorf("msg = %q, want %q", perr.Msg, tt.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package emsub
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	tokEOF = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokPunct
+)
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return fmt.Sprintf("string %q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// разбиение на лексемы: идентификаторы, строки в одинарных или двойных кавычках, числа, операторы
+func lex(src string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, token{tokPunct, string(r), i})
+			i++
+		case r == '=' || r == '!' || r == '<' || r == '>':
+			op := string(r)
+			if i+1 < len(src) && (src[i+1] == '=' || (r == '<' && src[i+1] == '>')) {
+				op = src[i : i+2]
+			}
+			if op == "!" {
+				return nil, &ParseError{i, `unexpected "!", did you mean "!="`}
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		case r == '"' || r == '\'':
+			s, n, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokString, s, i})
+			i += n
+		case r >= '0' && r <= '9':
+			j := i
+			for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, src[i:j], i})
+			i = j
+		case r == '_' || unicode.IsLetter(r):
+			j := i
+			for j < len(src) {
+				r, size := utf8.DecodeRuneInString(src[j:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				j += size
+			}
+			tokens = append(tokens, token{tokIdent, src[i:j], i})
+			i = j
+		default:
+			return nil, &ParseError{i, fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src)}), nil
+}
+
+// строка до закрывающей кавычки, \ экранирует следующий символ
+func lexString(src string, start int) (string, int, error) {
+	quote := src[start]
+	var b strings.Builder
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			if i+1 < len(src) {
+				i++
+				b.WriteByte(src[i])
+			}
+		case quote:
+			return b.String(), i + 1 - start, nil
+		default:
+			b.WriteByte(src[i])
+		}
+	}
+	return "", 0, &ParseError{start, "unterminated string"}
+}
@@ -0,0 +1,98 @@
+package emsub
+
+import (
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// разобранное выражение, реализует model.FilterExpr
+type Expr interface {
+	Where(alias string) (string, []any, error)
+	sqlizer(alias string) sq.Sqlizer
+}
+
+// условия, объединенные AND или OR
+type group struct {
+	op    string
+	items []Expr
+}
+
+func (g *group) Where(alias string) (string, []any, error) {
+	return g.sqlizer(alias).ToSql()
+}
+
+func (g *group) sqlizer(alias string) sq.Sqlizer {
+	if g.op == "OR" {
+		cond := sq.Or{}
+		for _, e := range g.items {
+			cond = append(cond, e.sqlizer(alias))
+		}
+		return cond
+	}
+	cond := sq.And{}
+	for _, e := range g.items {
+		cond = append(cond, e.sqlizer(alias))
+	}
+	return cond
+}
+
+// сравнение поля со значениями; nil в values - null
+type condition struct {
+	field  string
+	op     string
+	kind   int
+	values []any
+}
+
+func (c *condition) Where(alias string) (string, []any, error) {
+	return c.sqlizer(alias).ToSql()
+}
+
+func (c *condition) sqlizer(alias string) sq.Sqlizer {
+	col := c.field
+	if alias != "" {
+		col = alias + "." + c.field
+	}
+	v := c.values[0]
+	// бессрочная подписка заканчивается позже любой даты
+	open := c.field == "end_date" && v != nil
+
+	switch c.op {
+	case "=":
+		return sq.Eq{col: v}
+	case "!=":
+		if open {
+			return sq.Or{sq.NotEq{col: v}, sq.Eq{col: nil}}
+		}
+		return sq.NotEq{col: v}
+	case "<":
+		return sq.Lt{col: v}
+	case "<=":
+		return sq.LtOrEq{col: v}
+	case ">":
+		if open {
+			return sq.Or{sq.Gt{col: v}, sq.Eq{col: nil}}
+		}
+		return sq.Gt{col: v}
+	case ">=":
+		if open {
+			return sq.Or{sq.GtOrEq{col: v}, sq.Eq{col: nil}}
+		}
+		return sq.GtOrEq{col: v}
+	case "in":
+		return sq.Eq{col: c.values}
+	case "starts":
+		return sq.ILike{col: likeEscape(v.(string)) + "%"}
+	case "contains":
+		return sq.ILike{col: "%" + likeEscape(v.(string)) + "%"}
+	}
+	return sq.Expr("FALSE")
+}
+
+// экранирование спецсимволов LIKE
+var likeReplacer = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func likeEscape(s string) string {
+	return likeReplacer.Replace(s)
+}
@@ -0,0 +1,45 @@
+package emsub
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// логируем вызовы, как MiddlewareLog в REST API
+func unaryLog(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		reqtime := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, logger, info.FullMethod, reqtime, err)
+		return resp, err
+	}
+}
+
+func streamLog(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		reqtime := time.Now()
+		err := handler(srv, ss)
+		logCall(ss.Context(), logger, info.FullMethod, reqtime, err)
+		return err
+	}
+}
+
+func logCall(ctx context.Context, logger *zap.Logger, method string, reqtime time.Time, err error) {
+	var rid string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("x-request-id"); len(v) > 0 {
+			rid = v[0]
+		}
+	}
+	logger.Info("grpc_request",
+		zap.String("rid", rid),
+		zap.String("method", method),
+		zap.String("code", status.Code(err).String()),
+		zap.Duration("dur", time.Since(reqtime)),
+	)
+}
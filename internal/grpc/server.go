@@ -0,0 +1,288 @@
+package emsub
+
+import (
+	"context"
+	"errors"
+
+	config "github.com/glkeru/EM_Subscriptions/internal/config"
+	pb "github.com/glkeru/EM_Subscriptions/internal/grpc/pb"
+	interfaces "github.com/glkeru/EM_Subscriptions/internal/interfaces"
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	validate "github.com/glkeru/EM_Subscriptions/internal/validate"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// формат дат, как в REST API
+const DateFormat = validate.DateFormat
+
+// имя сервиса для health check
+const ServiceName = "emsub.v1.SubscriptionService"
+
+type Server struct {
+	pb.UnimplementedSubscriptionServiceServer
+	repo   interfaces.RepoSubcription
+	logger *zap.Logger
+	config *config.Config
+	health *health.Server
+}
+
+// gRPC сервер с сервисом подписок, health check и reflection
+func NewServer(repo interfaces.RepoSubcription, logger *zap.Logger, c *config.Config) (*grpc.Server, *Server) {
+	gs := grpc.NewServer(grpc.UnaryInterceptor(unaryLog(logger)), grpc.StreamInterceptor(streamLog(logger)))
+	server := &Server{repo: repo, logger: logger, config: c, health: health.NewServer()}
+
+	pb.RegisterSubscriptionServiceServer(gs, server)
+	healthpb.RegisterHealthServer(gs, server.health)
+	reflection.Register(gs)
+
+	server.health.SetServingStatus(ServiceName, healthpb.HealthCheckResponse_SERVING)
+	return gs, server
+}
+
+// перевод health check в NOT_SERVING перед остановкой
+func (s *Server) Shutdown() {
+	s.health.Shutdown()
+}
+
+// логирование ошибок
+func (s *Server) LogError(msg, service string, err error, data any) {
+	s.logger.Error(msg,
+		zap.String("service", service),
+		zap.Error(err),
+		zap.Any("data", data),
+	)
+}
+
+// ошибка репозитория в статус: подробности только в лог
+func (s *Server) repoError(msg, service string, err error, data any) error {
+	if errors.Is(err, model.ErrNotFound) {
+		return status.Error(codes.NotFound, "subscription not found")
+	}
+	s.LogError(msg, service, err, data)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// Create
+func (s *Server) Create(ctx context.Context, req *pb.CreateRequest) (*pb.CreateResponse, error) {
+	sub, err := subscriptionModel(req.GetSubscription())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	id, err := s.repo.SubscriptionCreate(ctx, *sub)
+	if err != nil {
+		return nil, s.repoError("DB create subscription", "Create", err, sub)
+	}
+	return &pb.CreateResponse{Id: id.String()}, nil
+}
+
+// Read
+func (s *Server) Read(ctx context.Context, req *pb.ReadRequest) (*pb.Subscription, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "id format is wrong")
+	}
+	sub, err := s.repo.SubscriptionRead(ctx, id)
+	if err != nil {
+		return nil, s.repoError("DB read subscription", "Read", err, id)
+	}
+	return subscriptionMessage(*sub), nil
+}
+
+// Update
+func (s *Server) Update(ctx context.Context, req *pb.UpdateRequest) (*emptypb.Empty, error) {
+	id, err := uuid.Parse(req.GetSubscription().GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "id format is wrong")
+	}
+	sub, err := subscriptionModel(req.GetSubscription())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	sub.Id = id
+	err = s.repo.SubscriptionUpdate(ctx, *sub)
+	if err != nil {
+		return nil, s.repoError("DB update error", "Update", err, sub)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// Patch
+func (s *Server) Patch(ctx context.Context, req *pb.PatchRequest) (*emptypb.Empty, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "id format is wrong")
+	}
+	patch, err := patchModel(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	err = s.repo.SubscriptionPatch(ctx, id, patch)
+	if err != nil {
+		return nil, s.repoError("DB update error", "Patch", err, id)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// Delete
+func (s *Server) Delete(ctx context.Context, req *pb.DeleteRequest) (*emptypb.Empty, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "id format is wrong")
+	}
+	err = s.repo.SubscriptionDelete(ctx, id)
+	if err != nil {
+		return nil, s.repoError("DB delete subscription", "Delete", err, id)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// List
+func (s *Server) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	f, err := validate.Filter(req.GetUserId(), req.GetServiceName(), req.GetStartDate(), req.GetEndDate())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.GetLimit() < 0 || req.GetOffset() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit and offset must not be negative")
+	}
+	subs, err := s.repo.SubscriptionList(ctx, f, int(req.GetLimit()), int(req.GetOffset()), model.ListOptions{})
+	if err != nil {
+		return nil, s.repoError("DB list error", "List", err, req)
+	}
+
+	resp := &pb.ListResponse{Limit: req.GetLimit(), Offset: req.GetOffset()}
+	if resp.Limit == 0 {
+		resp.Limit = int32(s.config.Limit)
+	}
+	resp.Data = make([]*pb.Subscription, 0, len(subs))
+	for _, sub := range subs {
+		resp.Data = append(resp.Data, subscriptionMessage(sub))
+	}
+	return resp, nil
+}
+
+// ListStream: все подписки по фильтру через курсор, без limit
+func (s *Server) ListStream(req *pb.ListStreamRequest, stream grpc.ServerStreamingServer[pb.Subscription]) error {
+	f, err := validate.Filter(req.GetUserId(), req.GetServiceName(), req.GetStartDate(), req.GetEndDate())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	err = s.repo.SubscriptionExport(stream.Context(), f, func(sub model.Subscription) error {
+		return stream.Send(subscriptionMessage(sub))
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return s.repoError("DB export error", "ListStream", err, req)
+	}
+	return nil
+}
+
+// Total
+func (s *Server) Total(ctx context.Context, req *pb.TotalRequest) (*pb.TotalResponse, error) {
+	f, err := validate.Filter(req.GetUserId(), req.GetServiceName(), req.GetStartDate(), req.GetEndDate())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	groupBy, err := validate.GroupBy(req.GetGroupBy())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resp := &pb.TotalResponse{}
+	if len(groupBy) == 0 {
+		total, err := s.repo.SubscriptionTotal(ctx, f)
+		if err != nil {
+			return nil, s.repoError("DB total error", "Total", err, req)
+		}
+		resp.Total = uint64(total)
+		return resp, nil
+	}
+
+	groups, err := s.repo.SubscriptionTotalGroup(ctx, f, groupBy)
+	if err != nil {
+		return nil, s.repoError("DB total group error", "Total", err, req)
+	}
+	resp.Groups = make([]*pb.TotalGroup, 0, len(groups))
+	for _, g := range groups {
+		resp.Total += uint64(g.Total)
+		resp.Groups = append(resp.Groups, totalGroupMessage(g))
+	}
+	return resp, nil
+}
+
+// проверка обязательных полей - общая с REST API
+func subscriptionModel(m *pb.Subscription) (*model.Subscription, error) {
+	if m == nil {
+		return nil, errors.New("subscription is required")
+	}
+	// неверный user_id проверка отклонит как отсутствующий
+	user, _ := uuid.Parse(m.GetUserId())
+	return validate.Subscription(validate.SubscriptionInput{
+		ServiceName: m.GetServiceName(),
+		UserId:      user,
+		Price:       uint64(m.GetPrice()),
+		StartDate:   m.GetStartDate(),
+		EndDate:     m.GetEndDate(),
+	}, DateFormat)
+}
+
+func patchModel(req *pb.PatchRequest) (model.SubscriptionPatch, error) {
+	in := validate.PatchInput{
+		ServiceName: req.ServiceName,
+		UserId:      req.UserId,
+		StartDate:   req.StartDate,
+		EndDate:     req.EndDate,
+		ClearEnd:    req.GetClearEndDate(),
+	}
+	if req.Price != nil {
+		price := uint64(req.GetPrice())
+		in.Price = &price
+	}
+	p, err := validate.Patch(in)
+	if err != nil {
+		return p, err
+	}
+	if p.Empty() {
+		return p, errors.New("nothing to update")
+	}
+	return p, nil
+}
+
+func subscriptionMessage(sub model.Subscription) *pb.Subscription {
+	m := &pb.Subscription{
+		Id:          sub.Id.String(),
+		ServiceName: sub.ServiceName,
+		UserId:      sub.UserId.String(),
+		Price:       uint32(sub.Price),
+		StartDate:   sub.StartDate.Format(DateFormat),
+	}
+	if sub.EndDate != nil {
+		end := sub.EndDate.Format(DateFormat)
+		m.EndDate = &end
+	}
+	return m
+}
+
+func totalGroupMessage(g model.TotalGroup) *pb.TotalGroup {
+	m := &pb.TotalGroup{Total: uint64(g.Total), Count: int32(g.Count)}
+	m.ServiceName = g.ServiceName
+	if g.UserId != nil {
+		user := g.UserId.String()
+		m.UserId = &user
+	}
+	if g.Month != nil {
+		month := g.Month.Format(DateFormat)
+		m.Month = &month
+	}
+	return m
+}
@@ -11,9 +11,85 @@ import (
 type RepoSubcription interface {
 	SubscriptionCreate(ctx context.Context, s model.Subscription) (uuid.UUID, error)
 	SubscriptionRead(ctx context.Context, id uuid.UUID) (*model.Subscription, error)
+	SubscriptionExists(ctx context.Context, s model.Subscription) (bool, error)
 	SubscriptionUpdate(ctx context.Context, s model.Subscription) error
-	SubscriptionPatch(ctx context.Context, id uuid.UUID, fields map[string]any) error
+	SubscriptionPatch(ctx context.Context, id uuid.UUID, p model.SubscriptionPatch) error
+	SubscriptionPatchWith(ctx context.Context, id uuid.UUID, fn func(model.Subscription) (model.SubscriptionPatch, error)) error
 	SubscriptionDelete(ctx context.Context, id uuid.UUID) error
-	SubscriptionList(ctx context.Context, user uuid.UUID, service_name string, start *time.Time, end *time.Time, limit int, offset int) ([]model.Subscription, error)
-	SubscriptionTotal(ctx context.Context, user uuid.UUID, service_name string, start *time.Time, end *time.Time) (uint, error)
+	SubscriptionList(ctx context.Context, f model.Filter, limit int, offset int, opts model.ListOptions) ([]model.Subscription, error)
+	SubscriptionListPerUser(ctx context.Context, f model.Filter, limit int, offset int) ([]model.Subscription, error)
+	SubscriptionExport(ctx context.Context, f model.Filter, fn func(model.Subscription) error) error
+	SubscriptionTotal(ctx context.Context, f model.Filter) (uint, error)
+	SubscriptionTotalGroup(ctx context.Context, f model.Filter, groupBy []string) ([]model.TotalGroup, error)
+	SubscriptionTotalExplain(ctx context.Context, f model.Filter, groupBy []string) ([]model.TotalLine, []model.TotalGroup, error)
+	SubscriptionTimeSeries(ctx context.Context, f model.Filter) ([]model.MonthTotal, error)
+	SubscriptionChurn(ctx context.Context, f model.Filter) ([]model.ChurnPoint, error)
+	SubscriptionRetention(ctx context.Context, f model.Filter, periods int) ([]model.Cohort, error)
+	SubscriptionMRR(ctx context.Context, f model.Filter) ([]model.MRRPoint, error)
+	SubscriptionPriceStats(ctx context.Context, f model.Filter) (*model.PriceStats, error)
+	SubscriptionPriceHistory(ctx context.Context, f model.Filter) ([]model.PriceStats, error)
+	SubscriptionPriceBounds(ctx context.Context, service_name string, exclude uuid.UUID, k float64) (*model.PriceBounds, error)
+	SubscriptionAnomalies(ctx context.Context, f model.Filter, k float64, minSamples int, limit int, offset int) ([]model.PriceAnomaly, error)
+}
+
+type RepoBudget interface {
+	BudgetCreate(ctx context.Context, b model.Budget) (uuid.UUID, error)
+	BudgetRead(ctx context.Context, id uuid.UUID) (*model.Budget, error)
+	BudgetUpdate(ctx context.Context, b model.Budget) error
+	BudgetDelete(ctx context.Context, id uuid.UUID) error
+	BudgetList(ctx context.Context, user uuid.UUID, limit int, offset int) ([]model.Budget, error)
+	BudgetListAll(ctx context.Context, user uuid.UUID) ([]model.Budget, error)
+	BudgetMarkAlerted(ctx context.Context, id uuid.UUID, kind string, month time.Time) (bool, error)
+	BudgetUnmarkAlerted(ctx context.Context, id uuid.UUID, kind string, month time.Time) error
+}
+
+type RepoCategory interface {
+	CategorySet(ctx context.Context, c model.ServiceCategory) error
+	CategoryRead(ctx context.Context, service_name string) (*model.ServiceCategory, error)
+	CategoryReadMany(ctx context.Context, service_names []string) ([]model.ServiceCategory, error)
+	CategoryDelete(ctx context.Context, service_name string) error
+	CategoryList(ctx context.Context) ([]model.ServiceCategory, error)
+}
+
+type RepoCalendar interface {
+	CalendarTokenSet(ctx context.Context, user uuid.UUID, hash string) error
+	CalendarTokenRead(ctx context.Context, user uuid.UUID) (string, error)
+	CalendarTokenDelete(ctx context.Context, user uuid.UUID) error
+}
+
+type RepoIdempotency interface {
+	// захват ключа: nil - ключ свободен и занят этим запросом (в rec.CreatedAt - время захвата), иначе сохраненная запись.
+	// Истекшие записи и зависшие дольше lock незавершенные запросы перезаписываются
+	IdempotencyStart(ctx context.Context, rec *model.IdempotencyRecord, ttl, lock time.Duration) (*model.IdempotencyRecord, error)
+	// сохранение и удаление меняют только запись своей попытки; ErrNotFound - ключ перезаписан другим запросом
+	IdempotencySave(ctx context.Context, rec model.IdempotencyRecord) error
+	IdempotencyDelete(ctx context.Context, rec model.IdempotencyRecord) error
+}
+
+// все репозитории сервиса
+type Repository interface {
+	RepoSubcription
+	RepoBudget
+	RepoCategory
+	RepoCalendar
+	RepoIdempotency
+}
+
+// поток событий изменения подписок
+type Events interface {
+	Publish(eventType string, sub model.Subscription)
+	// события после lastId из буфера и канал новых; complete=false - часть событий уже вытеснена.
+	// Канал закрывается при отставании подписчика и при остановке.
+	Subscribe(lastId uint64) (replay []model.SubscriptionEvent, complete bool, events <-chan model.SubscriptionEvent, cancel func())
+}
+
+// отправка предупреждений по бюджетам
+type Notifier interface {
+	Notify(ctx context.Context, a model.BudgetAlert) error
+}
+
+// расчет бюджетов и фоновая проверка после изменений
+type Budgets interface {
+	Evaluate(ctx context.Context, b model.Budget) (*model.BudgetStatus, error)
+	Check(user uuid.UUID)
 }
@@ -14,3 +14,254 @@ type Subscription struct {
 	StartDate   time.Time
 	EndDate     *time.Time
 }
+
+// частичное обновление подписки: nil - поле не меняется
+type SubscriptionPatch struct {
+	ServiceName *string
+	UserId      *uuid.UUID
+	Price       *uint
+	StartDate   *time.Time
+	EndDate     *time.Time
+	ClearEnd    bool // сбросить end_date в NULL
+}
+
+// нет ни одного изменяемого поля
+func (p SubscriptionPatch) Empty() bool {
+	return p.ServiceName == nil && p.UserId == nil && p.Price == nil &&
+		p.StartDate == nil && p.EndDate == nil && !p.ClearEnd
+}
+
+// фильтр для агрегирующих запросов
+type Filter struct {
+	UserId      uuid.UUID
+	UserIds     []uuid.UUID // любой из пользователей, для пакетных запросов GraphQL
+	ServiceName string
+	Category    string
+	Start       *time.Time
+	End         *time.Time
+	Expr        FilterExpr
+}
+
+// ключ сортировки списка
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// сортировка и выбираемые поля списка, пустые - по умолчанию
+type ListOptions struct {
+	Sort   []SortKey
+	Fields []string
+}
+
+// разобранный параметр filter: SQL условие по таблице подписок с алиасом alias ("" - без алиаса),
+// плейсхолдеры - ?
+type FilterExpr interface {
+	Where(alias string) (string, []any, error)
+}
+
+// группировки суммы
+const (
+	GroupService = "service_name"
+	GroupUser    = "user_id"
+	GroupMonth   = "month"
+)
+
+// строка разбивки суммы: nil - поле не участвует в группировке
+type TotalGroup struct {
+	ServiceName *string
+	UserId      *uuid.UUID
+	Month       *time.Time
+	Total       uint
+	Count       int
+}
+
+// сумма за месяц
+type MonthTotal struct {
+	Month time.Time
+	Total uint
+	Count int
+}
+
+// категория сервиса
+type ServiceCategory struct {
+	ServiceName string
+	Category    string
+}
+
+// месячный бюджет пользователя, ограничивается сервисом или категорией
+type Budget struct {
+	Id          uuid.UUID
+	UserId      uuid.UUID
+	Amount      uint
+	ServiceName *string
+	Category    *string
+	Threshold   *uint // порог в % от суммы, nil - из конфига
+}
+
+// виды предупреждений по бюджету
+const (
+	AlertCurrent   = "current"   // расходы текущего месяца
+	AlertProjected = "projected" // ожидаемые расходы следующего месяца
+)
+
+// предупреждение о превышении порога бюджета
+type BudgetAlert struct {
+	BudgetId  uuid.UUID
+	UserId    uuid.UUID
+	Kind      string
+	Month     time.Time
+	Amount    uint
+	Spend     uint
+	Threshold uint
+}
+
+// состояние бюджета
+type BudgetStatus struct {
+	Budget    Budget
+	Month     time.Time
+	Current   uint
+	Projected uint
+	Threshold uint
+	Alerts    []BudgetAlert
+}
+
+// новые, ушедшие и активные подписки сервиса за месяц
+type ChurnPoint struct {
+	ServiceName string
+	Month       time.Time
+	New         int
+	Churned     int
+	Active      int
+}
+
+// когорта подписок по месяцу начала
+// Retained[k-1] - сколько активны через k месяцев, только для уже наступивших месяцев
+type Cohort struct {
+	Month    time.Time
+	Size     int
+	Retained []int
+}
+
+// MRR за месяц и его изменение относительно предыдущего месяца
+type MRRPoint struct {
+	Month       time.Time
+	MRR         uint
+	New         uint
+	Expansion   uint
+	Contraction uint
+	Churned     uint
+}
+
+// строка помесячного агрегата, расходящаяся с подписками
+type RollupDiff struct {
+	Month          time.Time
+	ServiceName    string
+	UserId         uuid.UUID
+	ExpectedAmount int64
+	ActualAmount   int64
+	ExpectedCount  int
+	ActualCount    int
+}
+
+// статистика цен сервиса, Month - для помесячной динамики
+type PriceStats struct {
+	Month       *time.Time
+	Subscribers int
+	Count       int
+	Min         uint
+	Max         uint
+	Mean        float64
+	Median      float64
+	P90         float64
+}
+
+// границы обычной цены сервиса по межквартильному размаху
+type PriceBounds struct {
+	ServiceName string
+	Count       int
+	Median      float64
+	Low         float64
+	High        float64
+}
+
+// выход цены за границы
+func (b PriceBounds) Outlier(price uint) bool {
+	return float64(price) < b.Low || float64(price) > b.High
+}
+
+// подписка с аномальной ценой
+type PriceAnomaly struct {
+	Subscription
+	Bounds PriceBounds
+}
+
+// виды рекомендаций по экономии
+const (
+	RecommendOverlap = "overlap"      // несколько сервисов одной категории
+	RecommendMedian  = "above_median" // цена выше медианы по сервису
+	RecommendAnnual  = "annual"       // давняя помесячная подписка, выгоднее годовой план
+)
+
+// рекомендация по экономии на подписках пользователя
+type Recommendation struct {
+	Kind          string
+	ServiceName   string
+	Category      string
+	Price         uint
+	Median        float64
+	Months        int
+	Alternatives  []string
+	YearlyCost    uint
+	YearlySavings uint
+}
+
+// годовой отчет по подпискам пользователя
+type UserReport struct {
+	UserId        uuid.UUID
+	Year          int
+	Total         uint
+	Services      []TotalGroup
+	Months        []MonthTotal
+	MostExpensive *Subscription
+	Started       []Subscription // начатые в году
+	Ended         []Subscription // закончившиеся в году
+}
+
+// вклад подписки в сумму за период
+type TotalLine struct {
+	Id           uuid.UUID
+	ServiceName  string
+	UserId       uuid.UUID
+	Price        uint
+	OverlapStart time.Time
+	OverlapEnd   time.Time
+	Months       int
+	Subtotal     uint
+}
+
+// изменения подписок для потока событий
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+)
+
+// событие изменения подписки, Id растет в пределах процесса
+type SubscriptionEvent struct {
+	Id           uint64
+	Type         string
+	Time         time.Time
+	Subscription Subscription
+}
+
+// сохраненный ответ на запрос с Idempotency-Key; Status = 0 - запрос еще выполняется
+type IdempotencyRecord struct {
+	Scope       string // метод и путь запроса
+	Key         string
+	RequestHash string
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time // время захвата ключа: отличает попытку от перезаписавших ключ после нее
+}
@@ -0,0 +1,43 @@
+package emsub
+
+import (
+	"context"
+	"fmt"
+
+	config "github.com/glkeru/EM_Subscriptions/internal/config"
+	interfaces "github.com/glkeru/EM_Subscriptions/internal/interfaces"
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	"go.uber.org/zap"
+)
+
+// выбор способа отправки предупреждений по конфигу
+func NewNotifier(c *config.Config, logger *zap.Logger) (interfaces.Notifier, error) {
+	switch c.Notifier {
+	case "", "log":
+		return NewLogNotifier(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", c.Notifier)
+	}
+}
+
+// предупреждения в лог
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	return &LogNotifier{logger}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, a model.BudgetAlert) error {
+	n.logger.Warn("budget threshold exceeded",
+		zap.String("budget", a.BudgetId.String()),
+		zap.String("user", a.UserId.String()),
+		zap.String("kind", a.Kind),
+		zap.Time("month", a.Month),
+		zap.Uint("amount", a.Amount),
+		zap.Uint("spend", a.Spend),
+		zap.Uint("threshold", a.Threshold),
+	)
+	return nil
+}
@@ -13,3 +13,13 @@ func ParseDate(s string, f string) (time.Time, error) {
 	}
 	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), nil
 }
+
+// первое число месяца
+func MonthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// кол-во месяцев в периоде, включая оба конца
+func MonthsBetween(start, end time.Time) int {
+	return (end.Year()-start.Year())*12 + int(end.Month()) - int(start.Month()) + 1
+}
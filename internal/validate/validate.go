@@ -0,0 +1,152 @@
+package emsub
+
+import (
+	"errors"
+	"fmt"
+
+	model "github.com/glkeru/EM_Subscriptions/internal/model"
+	utils "github.com/glkeru/EM_Subscriptions/internal/utils"
+	"github.com/google/uuid"
+)
+
+// проверка входных данных, общая для REST, GraphQL и gRPC
+
+// формат дат API: MM-YYYY
+const DateFormat = "01-2006"
+
+// цена хранится в INTEGER
+const MaxPrice = 1<<31 - 1
+
+// поля подписки из запроса, даты строками
+type SubscriptionInput struct {
+	ServiceName string
+	UserId      uuid.UUID
+	Price       uint64
+	StartDate   string
+	EndDate     string
+}
+
+// проверка обязательных полей и разбор дат подписки
+func Subscription(in SubscriptionInput, layout string) (*model.Subscription, error) {
+	if in.ServiceName == "" || in.Price == 0 || in.UserId == uuid.Nil || in.StartDate == "" {
+		return nil, errors.New("missing required fields, required: service_name, user_id, price, start_date")
+	}
+	if in.Price > MaxPrice {
+		return nil, errors.New("price is too large")
+	}
+
+	var err error
+	sub := &model.Subscription{ServiceName: in.ServiceName, UserId: in.UserId, Price: uint(in.Price)}
+	sub.StartDate, err = utils.ParseDate(in.StartDate, layout)
+	if err != nil {
+		return nil, fmt.Errorf("start_date parsing error: %w", err)
+	}
+	if in.EndDate != "" {
+		end, err := utils.ParseDate(in.EndDate, layout)
+		if err != nil {
+			return nil, fmt.Errorf("end_date parsing error: %w", err)
+		}
+		sub.EndDate = &end
+	}
+	return sub, nil
+}
+
+// поля частичного обновления, nil - не меняется
+type PatchInput struct {
+	ServiceName *string
+	UserId      *string
+	Price       *uint64
+	StartDate   *string
+	EndDate     *string
+	// сброс даты окончания
+	ClearEnd bool
+}
+
+func Patch(in PatchInput) (model.SubscriptionPatch, error) {
+	var p model.SubscriptionPatch
+	if in.ServiceName != nil {
+		if *in.ServiceName == "" {
+			return p, errors.New("service_name must be a non-empty string")
+		}
+		name := *in.ServiceName
+		p.ServiceName = &name
+	}
+	if in.UserId != nil {
+		user, err := uuid.Parse(*in.UserId)
+		if err != nil || user == uuid.Nil {
+			return p, errors.New("user_id must be a UUID string")
+		}
+		p.UserId = &user
+	}
+	if in.Price != nil {
+		if *in.Price == 0 || *in.Price > MaxPrice {
+			return p, errors.New("price must be a positive integer")
+		}
+		price := uint(*in.Price)
+		p.Price = &price
+	}
+	if in.StartDate != nil {
+		start, err := utils.ParseDate(*in.StartDate, DateFormat)
+		if err != nil {
+			return p, errors.New("start_date must be a string in MM-YYYY format")
+		}
+		p.StartDate = &start
+	}
+	if in.EndDate != nil && in.ClearEnd {
+		return p, errors.New("end_date cannot be set and cleared at the same time")
+	}
+	if in.EndDate != nil {
+		end, err := utils.ParseDate(*in.EndDate, DateFormat)
+		if err != nil {
+			return p, errors.New("end_date must be a string in MM-YYYY format or null")
+		}
+		p.EndDate = &end
+	}
+	p.ClearEnd = in.ClearEnd
+	return p, nil
+}
+
+// фильтры user_id, service_name, start_date, end_date: пустые значения не фильтруют
+func Filter(user, service, start, end string) (model.Filter, error) {
+	var f model.Filter
+	if user != "" {
+		id, err := uuid.Parse(user)
+		if err != nil {
+			return f, errors.New("user_id format is wrong")
+		}
+		f.UserId = id
+	}
+	f.ServiceName = service
+	if start != "" {
+		dt, err := utils.ParseDate(start, DateFormat)
+		if err != nil {
+			return f, errors.New("start_date format is wrong")
+		}
+		f.Start = &dt
+	}
+	if end != "" {
+		dt, err := utils.ParseDate(end, DateFormat)
+		if err != nil {
+			return f, errors.New("end_date format is wrong")
+		}
+		f.End = &dt
+	}
+	return f, nil
+}
+
+// группировки суммы без повторов, пустые пропускаются
+func GroupBy(values []string) ([]string, error) {
+	groups := make([]string, 0, 3)
+	seen := make(map[string]bool)
+	for _, g := range values {
+		if g == "" || seen[g] {
+			continue
+		}
+		if g != model.GroupService && g != model.GroupUser && g != model.GroupMonth {
+			return nil, errors.New("group_by must be service_name, user_id or month")
+		}
+		seen[g] = true
+		groups = append(groups, g)
+	}
+	return groups, nil
+}